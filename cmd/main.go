@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"log"
 	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/Sensrdt/coupon-system/docs/swagger" // swagger docs
 	"github.com/Sensrdt/coupon-system/internal/api"
 	"github.com/Sensrdt/coupon-system/internal/cache"
 	"github.com/Sensrdt/coupon-system/internal/db"
+	"github.com/Sensrdt/coupon-system/internal/model"
 	"github.com/Sensrdt/coupon-system/internal/service"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files" // swagger embed files
@@ -25,8 +31,32 @@ func main() {
 	}
 	dbConn := db.NewDB()
 	repo := db.NewRepository(dbConn.DB)
-	cache := cache.NewLRU(100)
-	couponService := service.NewCouponService(repo, cache)
+	cache, err := cache.New(context.Background(), cache.Config{
+		Backend:     os.Getenv("CACHE_BACKEND"),
+		Capacity:    envInt("CACHE_CAPACITY", 100),
+		TTL:         envDuration("CACHE_TTL", time.Minute),
+		RedisURL:    os.Getenv("REDIS_URL"),
+		RedisPrefix: os.Getenv("REDIS_PREFIX"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+	rounding, err := model.ParseRoundingMode(os.Getenv("ROUNDING_MODE"))
+	if err != nil {
+		log.Fatalf("Invalid ROUNDING_MODE: %v", err)
+	}
+	couponService := service.NewCouponServiceWithConfig(repo, cache, service.Config{
+		QualifyShipping: envBool("QUALIFY_SHIPPING"),
+		QualifyTax:      envBool("QUALIFY_TAX"),
+		QualifyFees:     envBool("QUALIFY_FEES"),
+		Rounding:        rounding,
+	})
+	if path := os.Getenv("RATES_FILE"); path != "" {
+		if err := loadRates(couponService, path); err != nil {
+			log.Fatalf("Failed to load RATES_FILE: %v", err)
+		}
+	}
+	couponService.StartReservationSweeper(context.Background(), time.Minute)
 	apiHandler := api.NewHandler(couponService)
 	r := gin.Default()
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -35,8 +65,76 @@ func main() {
 	{
 		router.POST("/applicable", apiHandler.GetApplicableCouponsHandler)
 		router.POST("/validate", apiHandler.ValidateCouponHandler)
+		router.POST("/redeem", apiHandler.RedeemCouponHandler)
+		router.POST("/reverse", apiHandler.ReverseRedemptionHandler)
+		router.POST("/reserve", apiHandler.ReserveCouponHandler)
+		router.POST("/reservations/:id/commit", apiHandler.CommitReservationHandler)
+		router.POST("/reservations/:id/release", apiHandler.ReleaseReservationHandler)
+		router.GET("/ledger", apiHandler.ListLedgerEntriesHandler)
+		router.POST("/rates", apiHandler.SetExchangeRatesHandler)
+		router.GET("/rates", apiHandler.ListExchangeRatesHandler)
 		router.POST("/", apiHandler.CreateCouponHandler)
+		router.GET("", apiHandler.ListCouponsHandler)
+		router.GET("/:code", apiHandler.GetCouponHandler)
+		router.PUT("/:code", apiHandler.UpdateCouponHandler)
+		router.PATCH("/:code", apiHandler.PatchCouponHandler)
+		router.POST("/:code/deactivate", apiHandler.DeactivateCouponHandler)
+		router.DELETE("/:code", apiHandler.DeleteCouponHandler)
 	}
 
 	r.Run(":" + cfg)
 }
+
+// loadRates records the exchange rates listed in a JSON file, in the format the
+// rates endpoint accepts. Rates already recorded are not recorded again.
+func loadRates(couponService *service.CouponService, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rates []*model.ExchangeRate
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return err
+	}
+	return couponService.SetExchangeRates(context.Background(), rates)
+}
+
+// envInt reads a positive integer setting, falling back to def when unset
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid %s %q", name, value)
+	}
+	return n
+}
+
+// envDuration reads a duration setting such as "30s", falling back to def when unset
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid %s %q", name, value)
+	}
+	return d
+}
+
+// envBool reads a boolean setting such as "true", which is false when unset
+func envBool(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid %s %q", name, value)
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Sensrdt/coupon-system/internal/db"
+)
+
+const usage = `usage: migrate <command> [arg]
+
+commands:
+  up [version]   apply pending migrations, up to version if given
+  down [steps]   revert the last applied migration, or the last steps of them
+  status         list migrations and whether they are applied
+`
+
+// migrate manages the database schema named by DATABASE_URL
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	arg := 0
+	if flag.NArg() == 2 {
+		n, err := strconv.Atoi(flag.Arg(1))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid argument %q, expected a positive number", flag.Arg(1))
+		}
+		arg = n
+	}
+
+	dbConn, err := db.Connect()
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+	case "up":
+		count, err := dbConn.MigrateUp(ctx, arg)
+		if err != nil {
+			log.Fatalf("migrate up failed: %v", err)
+		}
+		log.Printf("%d migrations applied", count)
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		count, err := dbConn.MigrateDown(ctx, arg)
+		if err != nil {
+			log.Fatalf("migrate down failed: %v", err)
+		}
+		log.Printf("%d migrations reverted", count)
+	case "status":
+		statuses, err := dbConn.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("migrate status failed: %v", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		if err := dbConn.CheckSchema(ctx); err != nil {
+			log.Fatalf("schema check failed: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Sensrdt/coupon-system/internal/cache"
+	"github.com/Sensrdt/coupon-system/internal/db"
+	"github.com/Sensrdt/coupon-system/internal/service"
+)
+
+// reconcile recomputes coupon usage counts from the redemption ledger and reports
+// any drift. Run with -fix to overwrite the drifted usage counts.
+func main() {
+	fix := flag.Bool("fix", false, "overwrite usage counts that disagree with the ledger")
+	flag.Parse()
+
+	dbConn, err := db.Connect()
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+	}
+	defer dbConn.Close()
+
+	repo := db.NewRepository(dbConn.DB)
+	// Share the server's cache so fixed coupons are invalidated on every replica
+	couponCache, err := cache.New(context.Background(), cache.Config{
+		Backend:     os.Getenv("CACHE_BACKEND"),
+		RedisURL:    os.Getenv("REDIS_URL"),
+		RedisPrefix: os.Getenv("REDIS_PREFIX"),
+	})
+	if err != nil {
+		log.Fatalf("failed to create cache: %v", err)
+	}
+	couponService := service.NewCouponService(repo, couponCache)
+
+	drifts, err := couponService.ReconcileUsage(context.Background(), *fix)
+	if err != nil {
+		log.Fatalf("reconciliation failed: %v", err)
+	}
+
+	for _, drift := range drifts {
+		status := "drift"
+		if drift.Fixed {
+			status = "fixed"
+		}
+		log.Printf("%s: coupon %s (id %d) usage_count=%d ledger=%d", status, drift.Code, drift.CouponID, drift.UsageCount, drift.LedgerCount)
+	}
+	log.Printf("%d coupons drifted from the ledger", len(drifts))
+}
@@ -11,9 +11,25 @@ import (
 
 // CouponService defines the interface for coupon-related operations
 type CouponService interface {
-	GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.Coupon, error)
-	ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (bool, error)
+	GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.ApplicableCoupon, error)
+	ExplainApplicableCoupons(ctx context.Context, cart *model.Cart) (*model.ApplicabilityReport, error)
+	BestCoupons(ctx context.Context, cart *model.Cart) (*model.CouponCombination, error)
+	ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (*model.ValidationResult, error)
+	RedeemCoupon(ctx context.Context, code string, orderID string, cart *model.Cart) (*model.Redemption, error)
+	ReserveCoupon(ctx context.Context, code string, cart *model.Cart, ttl time.Duration) (*model.Reservation, error)
+	CommitReservation(ctx context.Context, id string, orderID string) (*model.Redemption, error)
+	ReleaseReservation(ctx context.Context, id string) (*model.Reservation, error)
+	ReverseRedemption(ctx context.Context, orderID string, refundAmount model.Money, reactivate bool) (*model.Reversal, error)
+	ListLedgerEntries(ctx context.Context, filter *model.LedgerFilter) ([]*model.LedgerEntry, error)
+	SetExchangeRates(ctx context.Context, rates []*model.ExchangeRate) error
+	ListExchangeRates(ctx context.Context, filter *model.ExchangeRateFilter) ([]*model.ExchangeRate, error)
 	CreateCoupon(ctx context.Context, coupon *model.Coupon) error
+	GetCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	ListCouponsPage(ctx context.Context, query *model.CouponQuery) (*model.CouponPage, error)
+	UpdateCoupon(ctx context.Context, code string, update *model.Coupon) (*model.Coupon, error)
+	PatchCoupon(ctx context.Context, code string, patch *model.CouponPatch) (*model.Coupon, error)
+	DeactivateCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	DeleteCoupon(ctx context.Context, code string) error
 }
 
 // Handler handles HTTP requests
@@ -30,8 +46,22 @@ func NewHandler(couponService CouponService) *Handler {
 
 // GetApplicableCouponsRequest represents the request body for getting applicable coupons
 type GetApplicableCouponsRequest struct {
-	Items []model.CartItem `json:"items"`
-	Total float64          `json:"total"`
+	CustomerID     string           `json:"customer_id"`
+	CustomerTier   string           `json:"customer_tier"`
+	Channel        string           `json:"channel"`
+	Currency       string           `json:"currency"`
+	Items          []model.CartItem `json:"items"`
+	ShippingMethod string           `json:"shipping_method"`
+	Shipping       model.Money      `json:"shipping"`
+	Tax            model.Money      `json:"tax"`
+	Fees           model.Money      `json:"fees"`
+	Total          model.Money      `json:"total"`
+}
+
+// ApplicableCouponsQuery represents the query parameters for getting applicable coupons
+type ApplicableCouponsQuery struct {
+	Explain bool `form:"explain"`
+	Best    bool `form:"best"`
 }
 
 // ValidateCouponRequest represents the request body for validating a coupon
@@ -42,49 +72,144 @@ type ValidateCouponRequest struct {
 
 // ValidateCouponResponse represents the response for coupon validation
 type ValidateCouponResponse struct {
-	Valid bool `json:"valid"`
+	Valid    bool                  `json:"valid"`
+	Discount *model.DiscountResult `json:"discount,omitempty"`
+	Reasons  []model.Reason        `json:"reasons,omitempty"`
+}
+
+// RedeemCouponRequest represents the request body for redeeming a coupon
+type RedeemCouponRequest struct {
+	Code    string     `json:"code"`
+	OrderID string     `json:"order_id"`
+	Cart    model.Cart `json:"cart"`
+}
+
+// ReserveCouponRequest represents the request body for reserving a coupon use
+type ReserveCouponRequest struct {
+	Code       string     `json:"code"`
+	Cart       model.Cart `json:"cart"`
+	TTLSeconds int        `json:"ttl_seconds"`
+}
+
+// CommitReservationRequest represents the request body for committing a reservation
+type CommitReservationRequest struct {
+	OrderID string `json:"order_id"`
+}
+
+// ReverseRedemptionRequest represents the request body for reversing a redemption
+type ReverseRedemptionRequest struct {
+	OrderID      string      `json:"order_id"`
+	RefundAmount model.Money `json:"refund_amount"`
+	Reactivate   bool        `json:"reactivate"`
+}
+
+// ExchangeRateRequest represents one rate in the request body for setting
+// exchange rates. A rate without an effective time takes effect now.
+type ExchangeRateRequest struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          float64   `json:"rate"`
+	EffectiveAt   time.Time `json:"effective_at"`
 }
 
 // CreateCouponRequest represents the request body for creating a coupon
 type CreateCouponRequest struct {
-	Code            string    `json:"code"`
-	DiscountType    string    `json:"discount_type"`
-	DiscountValue   float64   `json:"discount_value"`
-	MinOrderValue   float64   `json:"min_order_value"`
-	MaxDiscount     float64   `json:"max_discount"`
-	StartDate       time.Time `json:"start_date"`
-	EndDate         time.Time `json:"end_date"`
-	UsageLimit      int       `json:"usage_limit"`
-	IsActive        bool      `json:"is_active"`
-	ApplicableItems []string  `json:"applicable_items"`
+	Code              string               `json:"code"`
+	DiscountType      string               `json:"discount_type"`
+	DiscountValue     float64              `json:"discount_value"`
+	DiscountAmount    model.Money          `json:"discount_amount"`
+	MinOrderValue     model.Money          `json:"min_order_value"`
+	MaxDiscount       model.Money          `json:"max_discount"`
+	Currency          string               `json:"currency"`
+	Prices            []model.CouponPrice  `json:"prices"`
+	StartDate         time.Time            `json:"start_date"`
+	EndDate           time.Time            `json:"end_date"`
+	UsageLimit        int                  `json:"usage_limit"`
+	PerCustomerLimit  int                  `json:"per_customer_limit"`
+	FirstOrderOnly    bool                 `json:"first_order_only"`
+	Exclusive         bool                 `json:"exclusive"`
+	StackGroup        string               `json:"stack_group"`
+	Priority          int                  `json:"priority"`
+	IsActive          bool                 `json:"is_active"`
+	ApplicableItems   []string             `json:"applicable_items"`
+	IncludeCategories []string             `json:"include_categories"`
+	ExcludeCategories []string             `json:"exclude_categories"`
+	IncludeBrands     []string             `json:"include_brands"`
+	ExcludeBrands     []string             `json:"exclude_brands"`
+	ExcludeOnSale     bool                 `json:"exclude_on_sale"`
+	BuyQuantity       int                  `json:"buy_quantity"`
+	GetQuantity       int                  `json:"get_quantity"`
+	RewardItems       []string             `json:"reward_items"`
+	MaxApplications   int                  `json:"max_applications"`
+	Tiers             []model.DiscountTier `json:"tiers"`
+	ShippingMethods   []string             `json:"shipping_methods"`
+	Rule              string               `json:"rule"`
 }
 
 // GetApplicableCouponsHandler handles requests to get applicable coupons
 // @Summary Get applicable coupons
-// @Description Get coupons applicable to the given cart
+// @Description Get coupons applicable to the given cart. With explain set the response is a model.ApplicabilityReport that also lists the rejected coupons and why they were rejected. With best set the response is the model.CouponCombination that gives the largest discount under the stacking rules.
 // @Tags coupons
 // @Accept json
 // @Produce json
 // @Param request body GetApplicableCouponsRequest true "Cart items and total"
-// @Success 200 {array} model.Coupon
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Param explain query bool false "Also list rejected coupons with their reasons"
+// @Param best query bool false "Return the best combination of coupons instead"
+// @Success 200 {array} model.ApplicableCoupon
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /coupons/applicable [post]
 func (h *Handler) GetApplicableCouponsHandler(c *gin.Context) {
+	var query ApplicableCouponsQuery
+	if err := c.ShouldBindQuery(&query); err != nil || (query.Explain && query.Best) {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
 	var req GetApplicableCouponsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request format"})
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
 		return
 	}
 
 	cart := &model.Cart{
-		Items: req.Items,
-		Total: req.Total,
+		CustomerID:     req.CustomerID,
+		CustomerTier:   req.CustomerTier,
+		Channel:        req.Channel,
+		Items:          req.Items,
+		Currency:       req.Currency,
+		ShippingMethod: req.ShippingMethod,
+		Shipping:       req.Shipping,
+		Tax:            req.Tax,
+		Fees:           req.Fees,
+		Total:          req.Total,
+	}
+
+	if query.Explain {
+		report, err := h.couponService.ExplainApplicableCoupons(c.Request.Context(), cart)
+		if err != nil {
+			respondError(c, err, "Failed to get applicable coupons")
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	if query.Best {
+		combination, err := h.couponService.BestCoupons(c.Request.Context(), cart)
+		if err != nil {
+			respondError(c, err, "Failed to get applicable coupons")
+			return
+		}
+
+		c.JSON(http.StatusOK, combination)
+		return
 	}
 
 	coupons, err := h.couponService.GetApplicableCoupons(c.Request.Context(), cart)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get applicable coupons"})
+		respondError(c, err, "Failed to get applicable coupons")
 		return
 	}
 
@@ -93,29 +218,259 @@ func (h *Handler) GetApplicableCouponsHandler(c *gin.Context) {
 
 // ValidateCouponHandler handles requests to validate a coupon
 // @Summary Validate coupon
-// @Description Validate a coupon against cart items
+// @Description Validate a coupon against cart items. An invalid coupon comes with a reason code and message for every rule the cart failed.
 // @Tags coupons
 // @Accept json
 // @Produce json
 // @Param request body ValidateCouponRequest true "Coupon code and cart"
 // @Success 200 {object} ValidateCouponResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /coupons/validate [post]
 func (h *Handler) ValidateCouponHandler(c *gin.Context) {
 	var req ValidateCouponRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request format"})
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	result, err := h.couponService.ValidateCoupon(c.Request.Context(), req.Code, &req.Cart)
+	if err != nil {
+		respondError(c, err, "Failed to validate coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, ValidateCouponResponse{Valid: result.Valid, Discount: result.Discount, Reasons: result.Reasons})
+}
+
+// RedeemCouponHandler handles requests to redeem a coupon for an order
+// @Summary Redeem coupon
+// @Description Consume one use of a coupon for an order. Repeating the request for the same order returns the original redemption.
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body RedeemCouponRequest true "Coupon code, order ID and cart"
+// @Success 200 {object} model.Redemption
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/redeem [post]
+func (h *Handler) RedeemCouponHandler(c *gin.Context) {
+	var req RedeemCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	redemption, err := h.couponService.RedeemCoupon(c.Request.Context(), req.Code, req.OrderID, &req.Cart)
+	if err != nil {
+		respondError(c, err, "Failed to redeem coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, redemption)
+}
+
+// ReserveCouponHandler handles requests to hold a coupon use during checkout
+// @Summary Reserve coupon
+// @Description Hold one use of a coupon until it is committed, released or expires
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body ReserveCouponRequest true "Coupon code, cart and hold duration"
+// @Success 201 {object} model.Reservation
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/reserve [post]
+func (h *Handler) ReserveCouponHandler(c *gin.Context) {
+	var req ReserveCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	reservation, err := h.couponService.ReserveCoupon(c.Request.Context(), req.Code, &req.Cart, ttl)
+	if err != nil {
+		respondError(c, err, "Failed to reserve coupon")
+		return
+	}
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// CommitReservationHandler handles requests to commit a reservation to an order
+// @Summary Commit reservation
+// @Description Consume the coupon use held by a reservation for an order
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Param request body CommitReservationRequest true "Order ID"
+// @Success 200 {object} model.Redemption
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/reservations/{id}/commit [post]
+func (h *Handler) CommitReservationHandler(c *gin.Context) {
+	var req CommitReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	redemption, err := h.couponService.CommitReservation(c.Request.Context(), c.Param("id"), req.OrderID)
+	if err != nil {
+		respondError(c, err, "Failed to commit reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, redemption)
+}
+
+// ReleaseReservationHandler handles requests to release a reservation
+// @Summary Release reservation
+// @Description Give the coupon use held by a reservation back
+// @Tags coupons
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Success 200 {object} model.Reservation
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/reservations/{id}/release [post]
+func (h *Handler) ReleaseReservationHandler(c *gin.Context) {
+	reservation, err := h.couponService.ReleaseReservation(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err, "Failed to release reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// ReverseRedemptionHandler handles requests to reverse a redemption after a cancellation or refund
+// @Summary Reverse redemption
+// @Description Reverse an order's redemption. Omit refund_amount to cancel the order and give the coupon use back; a partial refund returns the prorated discount to claw back.
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body ReverseRedemptionRequest true "Order ID, refund amount and reactivation flag"
+// @Success 200 {object} model.Reversal
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/reverse [post]
+func (h *Handler) ReverseRedemptionHandler(c *gin.Context) {
+	var req ReverseRedemptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
 		return
 	}
 
-	valid, err := h.couponService.ValidateCoupon(c.Request.Context(), req.Code, &req.Cart)
+	reversal, err := h.couponService.ReverseRedemption(c.Request.Context(), req.OrderID, req.RefundAmount, req.Reactivate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to validate coupon"})
+		respondError(c, err, "Failed to reverse redemption")
 		return
 	}
 
-	c.JSON(http.StatusOK, ValidateCouponResponse{Valid: valid})
+	c.JSON(http.StatusOK, reversal)
+}
+
+// ListLedgerEntriesHandler handles requests to audit the redemption ledger
+// @Summary List ledger entries
+// @Description List redemption ledger entries, optionally filtered by coupon, order or customer
+// @Tags ledger
+// @Produce json
+// @Param coupon_code query string false "Coupon code"
+// @Param order_id query string false "Order ID"
+// @Param customer_id query string false "Customer ID"
+// @Success 200 {array} model.LedgerEntry
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/ledger [get]
+func (h *Handler) ListLedgerEntriesHandler(c *gin.Context) {
+	var filter model.LedgerFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	entries, err := h.couponService.ListLedgerEntries(c.Request.Context(), &filter)
+	if err != nil {
+		respondError(c, err, "Failed to list ledger entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// SetExchangeRatesHandler handles requests to record exchange rates
+// @Summary Set exchange rates
+// @Description Record exchange rates, each taking effect at its effective time or now
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param request body []ExchangeRateRequest true "Exchange rates"
+// @Success 201 {array} model.ExchangeRate
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/rates [post]
+func (h *Handler) SetExchangeRatesHandler(c *gin.Context) {
+	var req []ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	rates := make([]*model.ExchangeRate, 0, len(req))
+	for _, rate := range req {
+		rates = append(rates, &model.ExchangeRate{
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: rate.QuoteCurrency,
+			Rate:          rate.Rate,
+			EffectiveAt:   rate.EffectiveAt,
+		})
+	}
+
+	if err := h.couponService.SetExchangeRates(c.Request.Context(), rates); err != nil {
+		respondError(c, err, "Failed to set exchange rates")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rates)
+}
+
+// ListExchangeRatesHandler handles requests to list the exchange rates in effect
+// @Summary List exchange rates
+// @Description List the rate of every currency pair in effect now, or at the given time
+// @Tags rates
+// @Produce json
+// @Param at query string false "Time the rates are in effect at (RFC 3339)"
+// @Success 200 {array} model.ExchangeRate
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/rates [get]
+func (h *Handler) ListExchangeRatesHandler(c *gin.Context) {
+	var filter model.ExchangeRateFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	rates, err := h.couponService.ListExchangeRates(c.Request.Context(), &filter)
+	if err != nil {
+		respondError(c, err, "Failed to list exchange rates")
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
 }
 
 // CreateCouponHandler handles requests to create a coupon
@@ -126,40 +481,213 @@ func (h *Handler) ValidateCouponHandler(c *gin.Context) {
 // @Produce json
 // @Param request body CreateCouponRequest true "Coupon details"
 // @Success 201 {object} model.Coupon
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /coupons/create [post]
 func (h *Handler) CreateCouponHandler(c *gin.Context) {
 	var req CreateCouponRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request format"})
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
 		return
 	}
 
-	coupon := &model.Coupon{
-		Code:            req.Code,
-		DiscountType:    req.DiscountType,
-		DiscountValue:   req.DiscountValue,
-		MinOrderValue:   req.MinOrderValue,
-		MaxDiscount:     req.MaxDiscount,
-		StartDate:       req.StartDate,
-		EndDate:         req.EndDate,
-		UsageLimit:      req.UsageLimit,
-		IsActive:        req.IsActive,
-		ApplicableItems: req.ApplicableItems,
-	}
-
+	coupon := req.toCoupon()
 	if err := h.couponService.CreateCoupon(c.Request.Context(), coupon); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create coupon"})
+		respondError(c, err, "Failed to create coupon")
 		return
 	}
 
 	c.JSON(http.StatusCreated, coupon)
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// GetCouponHandler handles requests to get a coupon
+// @Summary Get coupon
+// @Description Get a coupon by its code
+// @Tags coupons
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Success 200 {object} model.Coupon
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/{code} [get]
+func (h *Handler) GetCouponHandler(c *gin.Context) {
+	coupon, err := h.couponService.GetCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		respondError(c, err, "Failed to get coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// ListCouponsHandler handles requests to list coupons
+// @Summary List coupons
+// @Description List one page of coupons, optionally filtered by status, validity window, discount type, items or order total. Pass next_cursor back as cursor to get the following page.
+// @Tags coupons
+// @Produce json
+// @Param active query bool false "Active flag"
+// @Param valid_from query string false "Start of the validity window (RFC 3339)"
+// @Param valid_to query string false "End of the validity window (RFC 3339)"
+// @Param discount_type query string false "Discount type"
+// @Param item query []string false "Item IDs or SKUs the coupon may apply to" collectionFormat(multi)
+// @Param category query []string false "Category IDs the coupon may apply to" collectionFormat(multi)
+// @Param brand query []string false "Brands the coupon may apply to" collectionFormat(multi)
+// @Param order_total query number false "Only coupons whose minimum order value this total reaches"
+// @Param sort query string false "Sort field: created_at, end_date or code"
+// @Param desc query bool false "Sort descending"
+// @Param limit query int false "Page size, at most 200"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Success 200 {object} model.CouponPage
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons [get]
+func (h *Handler) ListCouponsHandler(c *gin.Context) {
+	var query model.CouponQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	page, err := h.couponService.ListCouponsPage(c.Request.Context(), &query)
+	if err != nil {
+		respondError(c, err, "Failed to list coupons")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// UpdateCouponHandler handles requests to replace a coupon
+// @Summary Update coupon
+// @Description Replace the editable fields of a coupon. The code and usage count are kept.
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Param request body CreateCouponRequest true "Coupon details"
+// @Success 200 {object} model.Coupon
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/{code} [put]
+func (h *Handler) UpdateCouponHandler(c *gin.Context) {
+	var req CreateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	coupon, err := h.couponService.UpdateCoupon(c.Request.Context(), c.Param("code"), req.toCoupon())
+	if err != nil {
+		respondError(c, err, "Failed to update coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// PatchCouponHandler handles requests to partially update a coupon
+// @Summary Patch coupon
+// @Description Update only the given fields of a coupon
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Param request body model.CouponPatch true "Fields to update"
+// @Success 200 {object} model.Coupon
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/{code} [patch]
+func (h *Handler) PatchCouponHandler(c *gin.Context) {
+	var patch model.CouponPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		respondProblem(c, http.StatusBadRequest, "invalid_request", "Invalid request format")
+		return
+	}
+
+	coupon, err := h.couponService.PatchCoupon(c.Request.Context(), c.Param("code"), &patch)
+	if err != nil {
+		respondError(c, err, "Failed to update coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeactivateCouponHandler handles requests to deactivate a coupon
+// @Summary Deactivate coupon
+// @Description Switch a coupon off without deleting it
+// @Tags coupons
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Success 200 {object} model.Coupon
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/{code}/deactivate [post]
+func (h *Handler) DeactivateCouponHandler(c *gin.Context) {
+	coupon, err := h.couponService.DeactivateCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		respondError(c, err, "Failed to deactivate coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCouponHandler handles requests to delete a coupon
+// @Summary Delete coupon
+// @Description Soft delete a coupon, keeping its redemption history
+// @Tags coupons
+// @Param code path string true "Coupon code"
+// @Success 204
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /coupons/{code} [delete]
+func (h *Handler) DeleteCouponHandler(c *gin.Context) {
+	if err := h.couponService.DeleteCoupon(c.Request.Context(), c.Param("code")); err != nil {
+		respondError(c, err, "Failed to delete coupon")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// toCoupon converts the request into a coupon
+func (req *CreateCouponRequest) toCoupon() *model.Coupon {
+	return &model.Coupon{
+		Code:              req.Code,
+		DiscountType:      req.DiscountType,
+		DiscountValue:     req.DiscountValue,
+		DiscountAmount:    req.DiscountAmount,
+		MinOrderValue:     req.MinOrderValue,
+		MaxDiscount:       req.MaxDiscount,
+		Currency:          req.Currency,
+		Prices:            req.Prices,
+		StartDate:         req.StartDate,
+		EndDate:           req.EndDate,
+		UsageLimit:        req.UsageLimit,
+		PerCustomerLimit:  req.PerCustomerLimit,
+		FirstOrderOnly:    req.FirstOrderOnly,
+		Exclusive:         req.Exclusive,
+		StackGroup:        req.StackGroup,
+		Priority:          req.Priority,
+		IsActive:          req.IsActive,
+		ApplicableItems:   req.ApplicableItems,
+		IncludeCategories: req.IncludeCategories,
+		ExcludeCategories: req.ExcludeCategories,
+		IncludeBrands:     req.IncludeBrands,
+		ExcludeBrands:     req.ExcludeBrands,
+		ExcludeOnSale:     req.ExcludeOnSale,
+		BuyQuantity:       req.BuyQuantity,
+		GetQuantity:       req.GetQuantity,
+		RewardItems:       req.RewardItems,
+		MaxApplications:   req.MaxApplications,
+		Tiers:             req.Tiers,
+		ShippingMethods:   req.ShippingMethods,
+		Rule:              req.Rule,
+	}
 }
 
 // requireJSON is a middleware that checks if the Content-Type header is set to application/json
@@ -167,7 +695,7 @@ func requireJSON() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		contentType := c.GetHeader("Content-Type")
 		if contentType != "application/json" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Content-Type must be application/json"})
+			abortWithProblem(c, http.StatusBadRequest, "invalid_content_type", "Content-Type must be application/json")
 			return
 		}
 		c.Next()
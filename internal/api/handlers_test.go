@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/Sensrdt/coupon-system/internal/model"
+	"github.com/Sensrdt/coupon-system/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -20,14 +23,88 @@ type MockCouponService struct {
 	mock.Mock
 }
 
-func (m *MockCouponService) GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.Coupon, error) {
+func (m *MockCouponService) GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.ApplicableCoupon, error) {
 	args := m.Called(ctx, cart)
-	return args.Get(0).([]*model.Coupon), args.Error(1)
+	return args.Get(0).([]*model.ApplicableCoupon), args.Error(1)
 }
 
-func (m *MockCouponService) ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (bool, error) {
+func (m *MockCouponService) ExplainApplicableCoupons(ctx context.Context, cart *model.Cart) (*model.ApplicabilityReport, error) {
+	args := m.Called(ctx, cart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ApplicabilityReport), args.Error(1)
+}
+
+func (m *MockCouponService) BestCoupons(ctx context.Context, cart *model.Cart) (*model.CouponCombination, error) {
+	args := m.Called(ctx, cart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.CouponCombination), args.Error(1)
+}
+
+func (m *MockCouponService) ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (*model.ValidationResult, error) {
 	args := m.Called(ctx, code, cart)
-	return args.Bool(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ValidationResult), args.Error(1)
+}
+
+func (m *MockCouponService) RedeemCoupon(ctx context.Context, code string, orderID string, cart *model.Cart) (*model.Redemption, error) {
+	args := m.Called(ctx, code, orderID, cart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Redemption), args.Error(1)
+}
+
+func (m *MockCouponService) ReserveCoupon(ctx context.Context, code string, cart *model.Cart, ttl time.Duration) (*model.Reservation, error) {
+	args := m.Called(ctx, code, cart, ttl)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Reservation), args.Error(1)
+}
+
+func (m *MockCouponService) CommitReservation(ctx context.Context, id string, orderID string) (*model.Redemption, error) {
+	args := m.Called(ctx, id, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Redemption), args.Error(1)
+}
+
+func (m *MockCouponService) ReleaseReservation(ctx context.Context, id string) (*model.Reservation, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Reservation), args.Error(1)
+}
+
+func (m *MockCouponService) ReverseRedemption(ctx context.Context, orderID string, refundAmount model.Money, reactivate bool) (*model.Reversal, error) {
+	args := m.Called(ctx, orderID, refundAmount, reactivate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Reversal), args.Error(1)
+}
+
+func (m *MockCouponService) ListLedgerEntries(ctx context.Context, filter *model.LedgerFilter) ([]*model.LedgerEntry, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*model.LedgerEntry), args.Error(1)
+}
+
+func (m *MockCouponService) SetExchangeRates(ctx context.Context, rates []*model.ExchangeRate) error {
+	args := m.Called(ctx, rates)
+	return args.Error(0)
+}
+
+func (m *MockCouponService) ListExchangeRates(ctx context.Context, filter *model.ExchangeRateFilter) ([]*model.ExchangeRate, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*model.ExchangeRate), args.Error(1)
 }
 
 func (m *MockCouponService) CreateCoupon(ctx context.Context, coupon *model.Coupon) error {
@@ -35,6 +112,51 @@ func (m *MockCouponService) CreateCoupon(ctx context.Context, coupon *model.Coup
 	return args.Error(0)
 }
 
+func (m *MockCouponService) GetCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	args := m.Called(ctx, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Coupon), args.Error(1)
+}
+
+func (m *MockCouponService) ListCouponsPage(ctx context.Context, query *model.CouponQuery) (*model.CouponPage, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.CouponPage), args.Error(1)
+}
+
+func (m *MockCouponService) UpdateCoupon(ctx context.Context, code string, update *model.Coupon) (*model.Coupon, error) {
+	args := m.Called(ctx, code, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Coupon), args.Error(1)
+}
+
+func (m *MockCouponService) PatchCoupon(ctx context.Context, code string, patch *model.CouponPatch) (*model.Coupon, error) {
+	args := m.Called(ctx, code, patch)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Coupon), args.Error(1)
+}
+
+func (m *MockCouponService) DeactivateCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	args := m.Called(ctx, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Coupon), args.Error(1)
+}
+
+func (m *MockCouponService) DeleteCoupon(ctx context.Context, code string) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
 func setupTestRouter() (*gin.Engine, *MockCouponService) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -44,7 +166,21 @@ func setupTestRouter() (*gin.Engine, *MockCouponService) {
 	// Apply middleware to routes
 	router.POST("/applicable", requireJSON(), handler.GetApplicableCouponsHandler)
 	router.POST("/validate", requireJSON(), handler.ValidateCouponHandler)
+	router.POST("/redeem", requireJSON(), handler.RedeemCouponHandler)
+	router.POST("/reverse", requireJSON(), handler.ReverseRedemptionHandler)
+	router.POST("/reserve", requireJSON(), handler.ReserveCouponHandler)
+	router.POST("/reservations/:id/commit", requireJSON(), handler.CommitReservationHandler)
+	router.POST("/reservations/:id/release", handler.ReleaseReservationHandler)
 	router.POST("/", requireJSON(), handler.CreateCouponHandler)
+	router.GET("/ledger", handler.ListLedgerEntriesHandler)
+	router.POST("/rates", handler.SetExchangeRatesHandler)
+	router.GET("/rates", handler.ListExchangeRatesHandler)
+	router.GET("/coupons", handler.ListCouponsHandler)
+	router.GET("/coupons/:code", handler.GetCouponHandler)
+	router.PUT("/coupons/:code", requireJSON(), handler.UpdateCouponHandler)
+	router.PATCH("/coupons/:code", requireJSON(), handler.PatchCouponHandler)
+	router.POST("/coupons/:code/deactivate", handler.DeactivateCouponHandler)
+	router.DELETE("/coupons/:code", handler.DeleteCouponHandler)
 
 	return router, mockService
 }
@@ -53,19 +189,22 @@ func TestGetApplicableCouponsHandler(t *testing.T) {
 	router, mockService := setupTestRouter()
 
 	// Mock data
-	coupons := []*model.Coupon{
+	coupons := []*model.ApplicableCoupon{
 		{
-			Code:            "TEST10",
-			DiscountType:    "percentage",
-			DiscountValue:   10,
-			MinOrderValue:   100,
-			MaxDiscount:     50,
-			StartDate:       time.Now(),
-			EndDate:         time.Now().Add(24 * time.Hour),
-			UsageLimit:      100,
-			UsageCount:      0,
-			IsActive:        true,
-			ApplicableItems: []string{"item1"},
+			Coupon: &model.Coupon{
+				Code:            "TEST10",
+				DiscountType:    "percentage",
+				DiscountValue:   10,
+				MinOrderValue:   10000,
+				MaxDiscount:     5000,
+				StartDate:       time.Now(),
+				EndDate:         time.Now().Add(24 * time.Hour),
+				UsageLimit:      100,
+				UsageCount:      0,
+				IsActive:        true,
+				ApplicableItems: []string{"item1"},
+			},
+			Discount: &model.DiscountResult{Subtotal: 15000, Discount: 1500, Total: 13500},
 		},
 	}
 
@@ -75,9 +214,9 @@ func TestGetApplicableCouponsHandler(t *testing.T) {
 	// Test data
 	request := GetApplicableCouponsRequest{
 		Items: []model.CartItem{
-			{ID: "item1", Price: 150},
+			{ID: "item1", Price: 15000},
 		},
-		Total: 150,
+		Total: 15000,
 	}
 
 	// Create request
@@ -91,11 +230,87 @@ func TestGetApplicableCouponsHandler(t *testing.T) {
 
 	// Assert response
 	assert.Equal(t, http.StatusOK, w.Code)
-	var response []*model.Coupon
+	var response []*model.ApplicableCoupon
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Len(t, response, 1)
 	assert.Equal(t, "TEST10", response[0].Code)
+	assert.Equal(t, model.Money(1500), response[0].Discount.Discount)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestExplainApplicableCouponsHandler(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	report := &model.ApplicabilityReport{
+		Applicable: []*model.ApplicableCoupon{{
+			Coupon:   &model.Coupon{Code: "TEST10"},
+			Discount: &model.DiscountResult{Subtotal: 15000, Discount: 1500, Total: 13500},
+		}},
+		Rejected: []*model.RejectedCoupon{{
+			Coupon:  &model.Coupon{Code: "OLD"},
+			Reasons: []model.Reason{{Code: model.ReasonCouponExpired, Message: "coupon expired"}},
+		}},
+	}
+	mockService.On("ExplainApplicableCoupons", mock.Anything, mock.AnythingOfType("*model.Cart")).Return(report, nil)
+
+	body, _ := json.Marshal(GetApplicableCouponsRequest{Items: []model.CartItem{{ID: "item1", Price: 15000}}, Total: 15000})
+	req, _ := http.NewRequest("POST", "/applicable?explain=true", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response model.ApplicabilityReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Applicable, 1)
+	assert.Len(t, response.Rejected, 1)
+	assert.Equal(t, "OLD", response.Rejected[0].Code)
+	assert.Equal(t, model.ReasonCouponExpired, response.Rejected[0].Reasons[0].Code)
+
+	// An unparsable explain flag is rejected
+	req, _ = http.NewRequest("POST", "/applicable?explain=maybe", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertNotCalled(t, "GetApplicableCoupons", mock.Anything, mock.Anything)
+	mockService.AssertExpectations(t)
+}
+
+func TestBestCouponsHandler(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	combination := &model.CouponCombination{
+		Coupons: []*model.ApplicableCoupon{
+			{Coupon: &model.Coupon{Code: "P20"}, Discount: &model.DiscountResult{Subtotal: 10000, Discount: 2000, Total: 8000}},
+			{Coupon: &model.Coupon{Code: "F15"}, Discount: &model.DiscountResult{Subtotal: 8000, Discount: 1500, Total: 6500}},
+		},
+		Discount: &model.DiscountResult{Subtotal: 10000, Discount: 3500, Total: 6500},
+	}
+	mockService.On("BestCoupons", mock.Anything, mock.AnythingOfType("*model.Cart")).Return(combination, nil)
+
+	body, _ := json.Marshal(GetApplicableCouponsRequest{Items: []model.CartItem{{ID: "item1", Price: 10000}}, Total: 10000})
+	req, _ := http.NewRequest("POST", "/applicable?best=true", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response model.CouponCombination
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Coupons, 2)
+	assert.Equal(t, "P20", response.Coupons[0].Code)
+	assert.Equal(t, model.Money(3500), response.Discount.Discount)
+
+	// The best and explain modes cannot be combined
+	req, _ = http.NewRequest("POST", "/applicable?best=true&explain=true", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	mockService.AssertExpectations(t)
 }
@@ -104,16 +319,17 @@ func TestValidateCouponHandler(t *testing.T) {
 	router, mockService := setupTestRouter()
 
 	// Setup expectations
-	mockService.On("ValidateCoupon", mock.Anything, "TEST10", mock.AnythingOfType("*model.Cart")).Return(true, nil)
+	mockService.On("ValidateCoupon", mock.Anything, "TEST10", mock.AnythingOfType("*model.Cart")).
+		Return(&model.ValidationResult{Valid: true, Discount: &model.DiscountResult{Subtotal: 15000, Discount: 1500, Total: 13500}}, nil)
 
 	// Test data
 	request := ValidateCouponRequest{
 		Code: "TEST10",
 		Cart: model.Cart{
 			Items: []model.CartItem{
-				{ID: "item1", Price: 150},
+				{ID: "item1", Price: 15000},
 			},
-			Total: 150,
+			Total: 15000,
 		},
 	}
 
@@ -132,6 +348,225 @@ func TestValidateCouponHandler(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.True(t, response.Valid)
+	assert.Equal(t, model.Money(13500), response.Discount.Total)
+	assert.Empty(t, response.Reasons)
+
+	// An invalid coupon explains why
+	reasons := []model.Reason{{Code: model.ReasonMinOrderValueNotMet, Message: "qualifying total 50.00 is below the minimum order value of 100.00"}}
+	mockService.On("ValidateCoupon", mock.Anything, "SMALL", mock.AnythingOfType("*model.Cart")).
+		Return(&model.ValidationResult{Valid: false, Reasons: reasons}, nil)
+
+	request.Code = "SMALL"
+	body, _ = json.Marshal(request)
+	req, _ = http.NewRequest("POST", "/validate", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	response = ValidateCouponResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Valid)
+	assert.Nil(t, response.Discount)
+	assert.Equal(t, reasons, response.Reasons)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestRedeemCouponHandler(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	// Setup expectations
+	mockService.On("RedeemCoupon", mock.Anything, "TEST10", "order-1", mock.AnythingOfType("*model.Cart")).
+		Return(&model.Redemption{ID: 1, CouponCode: "TEST10", OrderID: "order-1", Discount: 1500}, nil)
+	mockService.On("RedeemCoupon", mock.Anything, "TEST10", "order-2", mock.AnythingOfType("*model.Cart")).
+		Return(nil, model.ErrUsageLimitReached)
+
+	// Test data
+	request := RedeemCouponRequest{
+		Code:    "TEST10",
+		OrderID: "order-1",
+		Cart: model.Cart{
+			Items: []model.CartItem{
+				{ID: "item1", Price: 15000},
+			},
+			Total: 15000,
+		},
+	}
+
+	// Create request
+	body, _ := json.Marshal(request)
+	req, _ := http.NewRequest("POST", "/redeem", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert response
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response model.Redemption
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", response.OrderID)
+
+	// Exhausted coupon
+	request.OrderID = "order-2"
+	body, _ = json.Marshal(request)
+	req, _ = http.NewRequest("POST", "/redeem", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestReverseRedemptionHandler(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	// Setup expectations
+	mockService.On("ReverseRedemption", mock.Anything, "order-1", model.Money(5000), false).
+		Return(&model.Reversal{OrderID: "order-1", RefundAmount: 5000, Clawback: 500}, nil)
+	mockService.On("ReverseRedemption", mock.Anything, "order-2", model.Money(0), true).
+		Return(nil, model.ErrRedemptionNotFound)
+
+	// Partial refund
+	body, _ := json.Marshal(ReverseRedemptionRequest{OrderID: "order-1", RefundAmount: 5000})
+	req, _ := http.NewRequest("POST", "/reverse", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response model.Reversal
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(500), response.Clawback)
+
+	// Unknown order
+	body, _ = json.Marshal(ReverseRedemptionRequest{OrderID: "order-2", Reactivate: true})
+	req, _ = http.NewRequest("POST", "/reverse", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestReservationHandlers(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	// Setup expectations
+	mockService.On("ReserveCoupon", mock.Anything, "TEST10", mock.AnythingOfType("*model.Cart"), 2*time.Minute).
+		Return(&model.Reservation{ID: "res-1", CouponCode: "TEST10", Status: model.ReservationStatusActive}, nil)
+	mockService.On("CommitReservation", mock.Anything, "res-1", "order-1").
+		Return(&model.Redemption{ID: 1, CouponCode: "TEST10", OrderID: "order-1"}, nil)
+	mockService.On("ReleaseReservation", mock.Anything, "res-1").
+		Return(nil, model.ErrReservationNotActive)
+
+	// Reserve
+	body, _ := json.Marshal(ReserveCouponRequest{Code: "TEST10", TTLSeconds: 120})
+	req, _ := http.NewRequest("POST", "/reserve", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var reservation model.Reservation
+	err := json.Unmarshal(w.Body.Bytes(), &reservation)
+	assert.NoError(t, err)
+	assert.Equal(t, "res-1", reservation.ID)
+
+	// Commit
+	body, _ = json.Marshal(CommitReservationRequest{OrderID: "order-1"})
+	req, _ = http.NewRequest("POST", "/reservations/res-1/commit", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Releasing a committed reservation conflicts
+	req, _ = http.NewRequest("POST", "/reservations/res-1/release", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestListLedgerEntriesHandler(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	// Setup expectations
+	entries := []*model.LedgerEntry{
+		{ID: 1, CouponCode: "TEST10", OrderID: "order-1", Amount: 1500, Status: model.LedgerStatusRedeemed},
+	}
+	mockService.On("ListLedgerEntries", mock.Anything, &model.LedgerFilter{CouponCode: "TEST10"}).Return(entries, nil)
+
+	req, _ := http.NewRequest("GET", "/ledger?coupon_code=TEST10", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []*model.LedgerEntry
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response, 1)
+	assert.Equal(t, model.LedgerStatusRedeemed, response[0].Status)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestExchangeRatesHandlers(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	effective := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockService.On("SetExchangeRates", mock.Anything, []*model.ExchangeRate{
+		{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.08, EffectiveAt: effective},
+	}).Return(nil)
+	mockService.On("SetExchangeRates", mock.Anything, []*model.ExchangeRate{
+		{BaseCurrency: "EUR", QuoteCurrency: "EUR", Rate: 1},
+	}).Return(service.ErrInvalidExchangeRate)
+	mockService.On("ListExchangeRates", mock.Anything, &model.ExchangeRateFilter{At: &effective}).Return([]*model.ExchangeRate{
+		{ID: 1, BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.08, EffectiveAt: effective},
+	}, nil)
+
+	body := `[{"base_currency":"EUR","quote_currency":"USD","rate":1.08,"effective_at":"2026-01-01T00:00:00Z"}]`
+	req, _ := http.NewRequest("POST", "/rates", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	body = `[{"base_currency":"EUR","quote_currency":"EUR","rate":1}]`
+	req, _ = http.NewRequest("POST", "/rates", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_exchange_rate")
+
+	req, _ = http.NewRequest("GET", "/rates?at=2026-01-01T00:00:00Z", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []*model.ExchangeRate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Equal(t, 1.08, response[0].Rate)
 
 	mockService.AssertExpectations(t)
 }
@@ -144,17 +579,23 @@ func TestCreateCouponHandler(t *testing.T) {
 		Code:            "TEST10",
 		DiscountType:    "percentage",
 		DiscountValue:   10,
-		MinOrderValue:   100,
-		MaxDiscount:     50,
+		MinOrderValue:   10000,
+		MaxDiscount:     5000,
+		Currency:        "EUR",
+		Prices:          []model.CouponPrice{{Currency: "USD", MinOrderValue: 11000, MaxDiscount: 5500}},
 		StartDate:       time.Now(),
 		EndDate:         time.Now().Add(24 * time.Hour),
 		UsageLimit:      100,
 		IsActive:        true,
 		ApplicableItems: []string{"item1"},
+		Rule:            `channel == "web"`,
 	}
 
 	// Setup expectations
-	mockService.On("CreateCoupon", mock.Anything, mock.AnythingOfType("*model.Coupon")).Return(nil)
+	mockService.On("CreateCoupon", mock.Anything, mock.MatchedBy(func(coupon *model.Coupon) bool {
+		return coupon.Currency == "EUR" && coupon.MinOrderValue == 10000 && len(coupon.Prices) == 1 &&
+			coupon.Prices[0].MinOrderValue == 11000 && coupon.Rule == `channel == "web"`
+	})).Return(nil)
 
 	// Create request
 	body, _ := json.Marshal(request)
@@ -171,6 +612,131 @@ func TestCreateCouponHandler(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestCreateCouponErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"validation", service.ErrInvalidDateRange, http.StatusBadRequest, "invalid_date_range", "invalid date range"},
+		{"duplicate code", model.ErrCouponCodeExists, http.StatusConflict, "coupon_code_exists", "coupon code already exists"},
+		{"wrapped", fmt.Errorf("create: %w", model.ErrCouponCodeExists), http.StatusConflict, "coupon_code_exists", "coupon code already exists"},
+		{"detailed", service.ErrInvalidRule.WithDetail(`unknown name "order" at offset 0`), http.StatusBadRequest, "invalid_rule",
+			`invalid rule: unknown name "order" at offset 0`},
+		{"internal", errors.New("connection refused"), http.StatusInternalServerError, "internal_error", "Failed to create coupon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mockService := setupTestRouter()
+			mockService.On("CreateCoupon", mock.Anything, mock.AnythingOfType("*model.Coupon")).Return(tt.err)
+
+			body, _ := json.Marshal(CreateCouponRequest{Code: "TEST10", DiscountType: "flat", DiscountAmount: 1000})
+			req, _ := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+			var problem Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, Problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.status),
+				Status:   tt.status,
+				Detail:   tt.detail,
+				Instance: "/",
+				Code:     tt.code,
+			}, problem)
+		})
+	}
+}
+
+func TestRequestProblems(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	// A body that is not JSON
+	req, _ := http.NewRequest("POST", "/validate", bytes.NewBufferString("{"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var problem Problem
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "invalid_request", problem.Code)
+	assert.Equal(t, "/validate", problem.Instance)
+
+	// A body that is not declared as JSON
+	req, _ = http.NewRequest("POST", "/validate", bytes.NewBufferString("{}"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "invalid_content_type", problem.Code)
+}
+
+func TestCouponCRUDHandlers(t *testing.T) {
+	router, mockService := setupTestRouter()
+
+	coupon := &model.Coupon{ID: 1, Code: "TEST10", DiscountType: "percentage", DiscountValue: 10, IsActive: true}
+	inactive := &model.Coupon{ID: 1, Code: "TEST10", DiscountType: "percentage", DiscountValue: 10}
+	active := true
+
+	// Setup expectations
+	mockService.On("GetCoupon", mock.Anything, "TEST10").Return(coupon, nil)
+	mockService.On("GetCoupon", mock.Anything, "MISSING").Return(nil, service.ErrCouponNotFound)
+	mockService.On("ListCouponsPage", mock.Anything, &model.CouponQuery{
+		CouponFilter: model.CouponFilter{Active: &active, DiscountType: "percentage", Items: []string{"item1", "item2"}},
+		Sort:         "code",
+		Limit:        10,
+	}).Return(&model.CouponPage{Coupons: []*model.Coupon{coupon}, NextCursor: "next"}, nil)
+	mockService.On("ListCouponsPage", mock.Anything, &model.CouponQuery{Cursor: "bogus"}).
+		Return(nil, model.ErrInvalidCursor)
+	mockService.On("UpdateCoupon", mock.Anything, "TEST10", mock.AnythingOfType("*model.Coupon")).
+		Return(nil, service.ErrInvalidDateRange)
+	mockService.On("PatchCoupon", mock.Anything, "TEST10", mock.AnythingOfType("*model.CouponPatch")).Return(coupon, nil)
+	mockService.On("DeactivateCoupon", mock.Anything, "TEST10").Return(inactive, nil)
+	mockService.On("DeleteCoupon", mock.Anything, "TEST10").Return(nil)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/coupons/TEST10", "", http.StatusOK},
+		{"GET", "/coupons/MISSING", "", http.StatusNotFound},
+		{"GET", "/coupons?active=true&discount_type=percentage&item=item1&item=item2&sort=code&limit=10", "", http.StatusOK},
+		{"GET", "/coupons?cursor=bogus", "", http.StatusBadRequest},
+		{"PUT", "/coupons/TEST10", `{"discount_type":"percentage","discount_value":10}`, http.StatusBadRequest},
+		{"PATCH", "/coupons/TEST10", `{"discount_value":12}`, http.StatusOK},
+		{"POST", "/coupons/TEST10/deactivate", "", http.StatusOK},
+		{"DELETE", "/coupons/TEST10", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, "%s %s", tt.method, tt.path)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
 func TestInvalidRequest(t *testing.T) {
 	router, _ := setupTestRouter()
 
@@ -190,7 +756,7 @@ func TestMissingContentType(t *testing.T) {
 	// Setup expectations - even though we expect a bad request due to content type,
 	// the handler might still try to call the service
 	mockService.On("GetApplicableCoupons", mock.Anything, mock.AnythingOfType("*model.Cart")).
-		Return([]*model.Coupon{}, nil)
+		Return([]*model.ApplicableCoupon{}, nil)
 
 	// Test missing content type
 	req, _ := http.NewRequest("POST", "/applicable", bytes.NewBufferString("{}"))
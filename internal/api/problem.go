@@ -0,0 +1,71 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem represents an RFC 7807 problem details response. Code is the stable
+// machine-readable error code clients should switch on.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// kindStatus maps each error kind to its HTTP status
+var kindStatus = map[model.ErrorKind]int{
+	model.KindValidation:    http.StatusBadRequest,
+	model.KindNotFound:      http.StatusNotFound,
+	model.KindConflict:      http.StatusConflict,
+	model.KindRuleViolation: http.StatusUnprocessableEntity,
+}
+
+// respondError writes the problem response for a failed operation. Cataloged
+// errors get the status of their kind; any other error is answered with 500 and
+// the given message, so internal details are not leaked.
+func respondError(c *gin.Context, err error, message string) {
+	var catalogErr *model.Error
+	if errors.As(err, &catalogErr) {
+		if status, ok := kindStatus[catalogErr.Kind]; ok {
+			respondProblem(c, status, catalogErr.Code, catalogErr.Error())
+			return
+		}
+	}
+
+	respondProblem(c, http.StatusInternalServerError, "internal_error", message)
+}
+
+// respondProblem writes a problem response
+func respondProblem(c *gin.Context, status int, code string, detail string) {
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(status, newProblem(c, status, code, detail))
+}
+
+// abortWithProblem writes a problem response and stops the handler chain
+func abortWithProblem(c *gin.Context, status int, code string, detail string) {
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(status, newProblem(c, status, code, detail))
+}
+
+// newProblem builds a problem for the request. The type is about:blank, so the
+// title is the status text and the code tells the problems apart.
+func newProblem(c *gin.Context, status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     code,
+	}
+}
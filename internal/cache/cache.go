@@ -1 +1,94 @@
 package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Supported cache backends
+const (
+	BackendLRU   = "lru"
+	BackendRedis = "redis"
+)
+
+// Cache stores values by key. Implementations are safe for concurrent use.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	// SetWithTTL stores a value that expires after ttl, a ttl of 0 never expires
+	SetWithTTL(key string, value interface{}, ttl time.Duration)
+	// SetWithTags stores a value with the default TTL and associates it with
+	// tags, so that InvalidateTag can drop it along with the other tagged entries
+	SetWithTags(key string, value interface{}, tags ...string)
+	// SetWithTagsUntil stores a tagged value like SetWithTags that expires by
+	// the deadline at the latest. A zero deadline keeps the default TTL and a
+	// deadline that has passed stores nothing.
+	SetWithTagsUntil(key string, value interface{}, deadline time.Time, tags ...string)
+	Delete(key string)
+	InvalidateTag(tag string)
+	Stats() Stats
+}
+
+// ttlUntil caps the ttl of an entry stored at now so that it expires by the
+// deadline. It reports false when the deadline has already passed.
+func ttlUntil(ttl time.Duration, deadline, now time.Time) (time.Duration, bool) {
+	if deadline.IsZero() {
+		return ttl, true
+	}
+
+	remaining := deadline.Sub(now)
+	if remaining <= 0 {
+		return 0, false
+	}
+	if ttl == 0 || remaining < ttl {
+		return remaining, true
+	}
+	return ttl, true
+}
+
+// Stats reports cache effectiveness counters since the cache was created
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Errors      uint64 `json:"errors"`
+	Size        int    `json:"size"`
+	Capacity    int    `json:"capacity"`
+}
+
+// Config selects and configures a cache backend
+type Config struct {
+	// Backend is BackendLRU (the default) or BackendRedis
+	Backend string
+	// Capacity bounds the in-process LRU. For the redis backend it sizes the
+	// local cache kept in front of Redis, and 0 disables it.
+	Capacity int
+	// TTL is how long entries live, 0 never expires
+	TTL time.Duration
+	// RedisURL and RedisPrefix configure the redis backend
+	RedisURL    string
+	RedisPrefix string
+}
+
+// New returns the cache backend selected by the config
+func New(ctx context.Context, cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case "", BackendLRU:
+		return NewLRUWithTTL(cfg.Capacity, cfg.TTL), nil
+	case BackendRedis:
+		c, err := NewRedis(ctx, RedisConfig{
+			URL:           cfg.RedisURL,
+			Prefix:        cfg.RedisPrefix,
+			TTL:           cfg.TTL,
+			LocalCapacity: cfg.Capacity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
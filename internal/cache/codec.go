@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	typesMu     sync.RWMutex
+	typesByName = make(map[string]reflect.Type)
+	namesByType = make(map[reflect.Type]string)
+)
+
+// Register makes values of the example's type storable in caches that serialize
+// their values, such as Redis. The name is stored alongside each value to decode
+// it back into the same type, so it must stay stable across releases.
+func Register(name string, example interface{}) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	t := reflect.TypeOf(example)
+	if existing, ok := typesByName[name]; ok && existing != t {
+		panic(fmt.Sprintf("cache: type name %q registered for both %v and %v", name, existing, t))
+	}
+	typesByName[name] = t
+	namesByType[t] = name
+}
+
+// encodeValue serializes a value of a registered type into its name and JSON
+func encodeValue(value interface{}) (string, json.RawMessage, error) {
+	typesMu.RLock()
+	name, ok := namesByType[reflect.TypeOf(value)]
+	typesMu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("cache: type %T is not registered", value)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, data, nil
+}
+
+// decodeValue deserializes JSON into a new value of the type registered under name
+func decodeValue(name string, data json.RawMessage) (interface{}, error) {
+	typesMu.RLock()
+	t, ok := typesByName[name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cache: unknown type %q", name)
+	}
+
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
@@ -3,49 +3,192 @@ package cache
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
-type Cache interface {
-	Get(key string) (interface{}, bool)
-	Set(key string, value interface{})
-	Delete(key string)
+// DefaultCapacity is used when an LRU is created with a non-positive capacity
+const DefaultCapacity = 100
+
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+	tags      []string
+}
+
+// expired reports whether the entry has a TTL that has passed at now
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
 }
 
 type lruCache struct {
-	mu    sync.RWMutex
-	cache map[string]interface{}
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	// queue holds the entries from most to least recently used
 	queue *list.List
+	// tags maps each tag to the keys of the entries carrying it
+	tags  map[string]map[string]struct{}
+	stats Stats
+	now   func() time.Time
 }
 
+// NewLRU returns a cache holding at most capacity entries that never expire,
+// evicting the least recently used entry when full
 func NewLRU(capacity int) Cache {
+	return NewLRUWithTTL(capacity, 0)
+}
+
+// NewLRUWithTTL returns an LRU cache whose Set entries expire after ttl
+func NewLRUWithTTL(capacity int, ttl time.Duration) Cache {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
 	return &lruCache{
-		cache: make(map[string]interface{}),
-		queue: list.New(),
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		queue:    list.New(),
+		tags:     make(map[string]map[string]struct{}),
+		now:      time.Now,
 	}
 }
 
 func (c *lruCache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	value, ok := c.cache[key]
-	return value, ok
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if e.expired(c.now()) {
+		c.remove(elem)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.queue.MoveToFront(elem)
+	c.stats.Hits++
+	return e.value, true
 }
 
 func (c *lruCache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *lruCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.setTagged(key, value, ttl, nil)
+}
+
+func (c *lruCache) SetWithTags(key string, value interface{}, tags ...string) {
+	c.setTagged(key, value, c.ttl, tags)
+}
+
+func (c *lruCache) SetWithTagsUntil(key string, value interface{}, deadline time.Time, tags ...string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.cache[key] = value
-	c.queue.PushFront(key)
 
-	if c.queue.Len() > 100 {
-		last := c.queue.Back()
-		delete(c.cache, last.Value.(string))
-		c.queue.Remove(last)
+	ttl, ok := ttlUntil(c.ttl, deadline, c.now())
+	if !ok {
+		return
+	}
+	c.set(key, value, ttl, tags)
+}
+
+// setTagged stores an entry with both an explicit TTL and tags
+func (c *lruCache) setTagged(key string, value interface{}, ttl time.Duration, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl, tags)
+}
+
+// set stores the entry at the front of the queue, replacing any previous value
+// and tags of the key, and evicts from the back until the cache fits
+func (c *lruCache) set(key string, value interface{}, ttl time.Duration, tags []string) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		c.untag(e)
+		e.value = value
+		e.expiresAt = expiresAt
+		e.tags = tags
+		c.tag(e)
+		c.queue.MoveToFront(elem)
+		return
+	}
+
+	e := &entry{key: key, value: value, expiresAt: expiresAt, tags: tags}
+	c.items[key] = c.queue.PushFront(e)
+	c.tag(e)
+	for c.queue.Len() > c.capacity {
+		c.remove(c.queue.Back())
+		c.stats.Evictions++
 	}
 }
 
 func (c *lruCache) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	delete(c.cache, key)
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *lruCache) InvalidateTag(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.tags[tag] {
+		c.remove(c.items[key])
+	}
+}
+
+func (c *lruCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.queue.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
+
+// remove drops the element from the map, the queue and the tag index
+func (c *lruCache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.queue.Remove(elem)
+	delete(c.items, e.key)
+	c.untag(e)
+}
+
+func (c *lruCache) tag(e *entry) {
+	for _, tag := range e.tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+}
+
+func (c *lruCache) untag(e *entry) {
+	for _, tag := range e.tags {
+		delete(c.tags[tag], e.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
 }
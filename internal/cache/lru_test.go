@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// keys returns the cached keys from most to least recently used
+func keys(c Cache) []string {
+	lru := c.(*lruCache)
+	var result []string
+	for elem := lru.queue.Front(); elem != nil; elem = elem.Next() {
+		result = append(result, elem.Value.(*entry).key)
+	}
+	return result
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(3)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	assert.Equal(t, []string{"c", "b", "a"}, keys(c))
+
+	// Reading a moves it to the front, so b is now the oldest
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "c", "b"}, keys(c))
+
+	c.Set("d", 4)
+	assert.Equal(t, []string{"d", "a", "c"}, keys(c))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	// Overwriting c refreshes it without duplicating it
+	c.Set("c", 30)
+	assert.Equal(t, []string{"c", "d", "a"}, keys(c))
+	c.Set("e", 5)
+	assert.Equal(t, []string{"e", "c", "d"}, keys(c))
+
+	value, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 30, value)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Evictions)
+	assert.Equal(t, 3, stats.Size)
+	assert.Equal(t, 3, stats.Capacity)
+}
+
+func TestLRUHonoursCapacity(t *testing.T) {
+	c := NewLRU(150)
+	for i := 0; i < 200; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+	assert.Equal(t, 150, c.Stats().Size)
+	assert.Equal(t, uint64(50), c.Stats().Evictions)
+
+	_, ok := c.Get("key49")
+	assert.False(t, ok)
+	_, ok = c.Get("key50")
+	assert.True(t, ok)
+
+	assert.Equal(t, DefaultCapacity, NewLRU(0).Stats().Capacity)
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	now := time.Now()
+	c := NewLRUWithTTL(10, time.Minute)
+	c.(*lruCache).now = func() time.Time { return now }
+
+	c.Set("default", 1)
+	c.SetWithTTL("short", 2, time.Second)
+	c.SetWithTTL("forever", 3, 0)
+
+	now = now.Add(2 * time.Second)
+	_, ok := c.Get("short")
+	assert.False(t, ok)
+	_, ok = c.Get("default")
+	assert.True(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("default")
+	assert.False(t, ok)
+	_, ok = c.Get("forever")
+	assert.True(t, ok)
+
+	// Overwriting resets the expiry
+	c.SetWithTTL("short", 4, time.Second)
+	value, ok := c.Get("short")
+	assert.True(t, ok)
+	assert.Equal(t, 4, value)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Expirations)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestLRUExpiresByDeadline(t *testing.T) {
+	now := time.Now()
+	c := NewLRUWithTTL(10, time.Minute)
+	c.(*lruCache).now = func() time.Time { return now }
+
+	c.SetWithTagsUntil("soon", 1, now.Add(time.Second), "coupon:X")
+	c.SetWithTagsUntil("later", 2, now.Add(time.Hour), "coupon:X")
+	c.SetWithTagsUntil("default", 3, time.Time{})
+	c.SetWithTagsUntil("passed", 4, now)
+
+	now = now.Add(2 * time.Second)
+	_, ok := c.Get("soon")
+	assert.False(t, ok)
+	_, ok = c.Get("later")
+	assert.True(t, ok)
+	_, ok = c.Get("passed")
+	assert.False(t, ok)
+
+	// The deadline never extends the default TTL
+	now = now.Add(time.Minute)
+	_, ok = c.Get("later")
+	assert.False(t, ok)
+	_, ok = c.Get("default")
+	assert.False(t, ok)
+
+	// and caps entries that would otherwise never expire
+	forever := NewLRU(10)
+	forever.(*lruCache).now = func() time.Time { return now }
+	forever.SetWithTagsUntil("a", 1, now.Add(time.Hour), "coupon:X")
+	now = now.Add(time.Hour)
+	_, ok = forever.Get("a")
+	assert.False(t, ok)
+}
+
+func TestLRUInvalidateTag(t *testing.T) {
+	c := NewLRU(3)
+
+	c.SetWithTags("a", 1, "coupon:X", "catalog")
+	c.SetWithTags("b", 2, "coupon:Y", "catalog")
+	c.SetWithTags("c", 3, "coupon:X")
+
+	c.InvalidateTag("coupon:X")
+	assert.Equal(t, []string{"b"}, keys(c))
+
+	// Retagging an entry drops its old tags
+	c.SetWithTags("b", 20, "coupon:Z")
+	c.InvalidateTag("catalog")
+	assert.Equal(t, []string{"b"}, keys(c))
+
+	// Evicted entries leave the tag index
+	c.SetWithTags("d", 4, "coupon:Z")
+	c.SetWithTags("e", 5)
+	c.SetWithTags("f", 6)
+	assert.Equal(t, []string{"f", "e", "d"}, keys(c))
+	assert.Len(t, c.(*lruCache).tags["coupon:Z"], 1)
+
+	c.InvalidateTag("coupon:Z")
+	c.InvalidateTag("unknown")
+	assert.Equal(t, []string{"f", "e"}, keys(c))
+	assert.Empty(t, c.(*lruCache).tags)
+}
+
+func TestLRUStats(t *testing.T) {
+	c := NewLRU(2)
+
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("missing")
+	c.Delete("a")
+	c.Get("a")
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(0), stats.Evictions)
+	assert.Equal(t, 0, stats.Size)
+}
+
+func TestLRUConcurrentAccess(t *testing.T) {
+	c := NewLRU(50)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("key%d", (i*j)%100)
+				c.Set(key, j)
+				c.Get(key)
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	assert.LessOrEqual(t, stats.Size, 50)
+	assert.Equal(t, stats.Size, len(c.(*lruCache).items))
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	ID    string  `json:"id"`
+	Price float64 `json:"price"`
+}
+
+type testResult struct {
+	Valid bool        `json:"valid"`
+	Items []*testItem `json:"items"`
+}
+
+func init() {
+	Register("test_result", &testResult{})
+	Register("test_items", []*testItem{})
+}
+
+func newTestRedis(t *testing.T, server *miniredis.Miniredis, localCapacity int) *RedisCache {
+	c, err := NewRedis(context.Background(), RedisConfig{
+		URL:           "redis://" + server.Addr(),
+		Prefix:        "test",
+		TTL:           time.Minute,
+		LocalCapacity: localCapacity,
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to redis: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRedisRoundTripsTypedValues(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 0)
+
+	result := &testResult{Valid: true, Items: []*testItem{{ID: "item1", Price: 9.99}}}
+	c.Set("result", result)
+	c.Set("items", []*testItem{{ID: "item2", Price: 5}})
+
+	value, ok := c.Get("result")
+	assert.True(t, ok)
+	assert.Equal(t, result, value)
+
+	value, ok = c.Get("items")
+	assert.True(t, ok)
+	assert.Equal(t, []*testItem{{ID: "item2", Price: 5}}, value)
+
+	_, ok = c.Get("missing")
+	assert.False(t, ok)
+
+	// Unregistered types cannot be serialized and are not stored
+	c.Set("unregistered", map[string]int{"a": 1})
+	_, ok = c.Get("unregistered")
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Errors)
+}
+
+func TestRedisExpiresEntries(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 0)
+
+	c.Set("default", &testResult{Valid: true})
+	c.SetWithTTL("short", &testResult{Valid: true}, time.Second)
+	c.SetWithTTL("forever", &testResult{Valid: true}, 0)
+
+	server.FastForward(2 * time.Second)
+	_, ok := c.Get("short")
+	assert.False(t, ok)
+	_, ok = c.Get("default")
+	assert.True(t, ok)
+
+	server.FastForward(time.Minute)
+	_, ok = c.Get("default")
+	assert.False(t, ok)
+	_, ok = c.Get("forever")
+	assert.True(t, ok)
+}
+
+func TestRedisExpiresByDeadline(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 0)
+
+	c.SetWithTagsUntil("soon", &testResult{Valid: true}, time.Now().Add(time.Second), "coupon:X")
+	c.SetWithTagsUntil("later", &testResult{Valid: true}, time.Now().Add(time.Hour), "coupon:X")
+	c.SetWithTagsUntil("passed", &testResult{Valid: true}, time.Now().Add(-time.Second))
+
+	server.FastForward(2 * time.Second)
+	_, ok := c.Get("soon")
+	assert.False(t, ok)
+	_, ok = c.Get("later")
+	assert.True(t, ok)
+	_, ok = c.Get("passed")
+	assert.False(t, ok)
+
+	// The deadline never extends the default TTL
+	server.FastForward(time.Minute)
+	_, ok = c.Get("later")
+	assert.False(t, ok)
+}
+
+func TestRedisInvalidateTag(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 0)
+
+	c.SetWithTags("a", &testResult{}, "coupon:X", "catalog")
+	c.SetWithTags("b", &testResult{}, "coupon:Y", "catalog")
+	c.SetWithTags("c", &testResult{}, "coupon:X")
+
+	c.InvalidateTag("coupon:X")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+	assert.False(t, server.Exists("test:tag:coupon:X"))
+
+	c.Delete("b")
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+}
+
+func TestRedisTagSetsOutliveTheirEntries(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 0)
+
+	// A shorter entry added later does not shorten the tag set
+	c.SetWithTags("long", &testResult{Valid: true}, "catalog")
+	c.SetWithTagsUntil("short", &testResult{Valid: true}, time.Now().Add(time.Second), "catalog")
+	server.FastForward(2 * time.Second)
+
+	c.InvalidateTag("catalog")
+	_, ok := c.Get("long")
+	assert.False(t, ok)
+
+	// A set holding an entry without a TTL never expires
+	forever, err := NewRedis(context.Background(), RedisConfig{URL: "redis://" + server.Addr(), Prefix: "test"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer forever.Close()
+
+	forever.SetWithTags("forever", &testResult{Valid: true}, "coupon:X")
+	forever.SetWithTagsUntil("short", &testResult{Valid: true}, time.Now().Add(time.Second), "coupon:X")
+	assert.Zero(t, server.TTL("test:tag:coupon:X"))
+	server.FastForward(time.Hour)
+
+	forever.InvalidateTag("coupon:X")
+	_, ok = forever.Get("forever")
+	assert.False(t, ok)
+}
+
+func TestRedisSkipsLocalCopiesRacingInvalidation(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newTestRedis(t, server, 10)
+
+	// A read that began before an invalidation finishes after it
+	generation := c.localGeneration()
+	c.InvalidateTag("coupon:X")
+	c.fillLocal(generation, "a", &testResult{Valid: true}, time.Minute, []string{"coupon:X"})
+	_, ok := c.local.Get("a")
+	assert.False(t, ok)
+
+	// Reads that do not race are copied
+	c.SetWithTags("b", &testResult{Valid: true}, "coupon:Y")
+	_, ok = c.local.Get("b")
+	assert.True(t, ok)
+}
+
+func TestRedisInvalidatesOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newTestRedis(t, server, 10)
+	second := newTestRedis(t, server, 10)
+	// A replica without a local cache, such as the reconcile command
+	writer := newTestRedis(t, server, 0)
+
+	first.SetWithTags("a", &testResult{Valid: true}, "coupon:X")
+	first.SetWithTags("b", &testResult{Valid: true}, "coupon:Y")
+
+	// The second replica reads through Redis and keeps local copies with their tags
+	_, ok := second.Get("a")
+	assert.True(t, ok)
+	_, ok = second.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 2, second.Stats().Size)
+
+	first.InvalidateTag("coupon:X")
+	assert.Eventually(t, func() bool {
+		_, ok := second.local.Get("a")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	_, ok = second.Get("a")
+	assert.False(t, ok)
+	_, ok = second.Get("b")
+	assert.True(t, ok)
+
+	writer.Delete("b")
+	assert.Eventually(t, func() bool {
+		_, firstOK := first.local.Get("b")
+		_, secondOK := second.local.Get("b")
+		return !firstOK && !secondOK
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewCacheBackends(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := New(ctx, Config{Capacity: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, c.Stats().Capacity)
+
+	server := miniredis.RunT(t)
+	c, err = New(ctx, Config{Backend: BackendRedis, RedisURL: "redis://" + server.Addr(), Capacity: 5})
+	assert.NoError(t, err)
+	assert.IsType(t, &RedisCache{}, c)
+	c.(*RedisCache).Close()
+
+	_, err = New(ctx, Config{Backend: BackendRedis, RedisURL: "not a url"})
+	assert.Error(t, err)
+
+	_, err = New(ctx, Config{Backend: "memcached"})
+	assert.Error(t, err)
+}
@@ -2,61 +2,48 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"sync"
+	"time"
 
 	"github.com/Sensrdt/coupon-system/internal/model"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// DB is the GORM-backed repository. It holds no locks of its own: usage limits
+// are enforced by conditional updates, so several replicas can share a database.
 type DB struct {
 	*gorm.DB
-	mu sync.RWMutex
 }
 
-// ValidateTables checks if required tables exist and creates them if they don't
-func (db *DB) ValidateTables() error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
-	// Drop and recreate tables to ensure schema is up to date
-	if db.Migrator().HasTable(&model.Coupon{}) {
-		log.Println("Dropping existing coupons table...")
-		if err := db.Migrator().DropTable(&model.Coupon{}); err != nil {
-			return fmt.Errorf("failed to drop tables: %v", err)
-		}
+// Connect opens the database named by DATABASE_URL without touching its schema,
+// with the pool configured from the DB_* environment variables
+func Connect() (*DB, error) {
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		dbURL = DefaultDatabaseURL
 	}
 
-	log.Println("Creating coupons table...")
-	if err := db.AutoMigrate(&model.Coupon{}); err != nil {
-		return fmt.Errorf("failed to create coupons table: %v", err)
+	pool, err := PoolConfigFromEnv()
+	if err != nil {
+		return nil, err
 	}
-	log.Println("Coupons table created successfully")
 
-	return nil
+	return Open(dbURL, pool)
 }
 
 func NewDB() *DB {
-	var err error
-
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		dbURL = "coupon.db"
-	}
-
-	db, err := gorm.Open(sqlite.Open(dbURL), &gorm.Config{})
+	dbInstance, err := Connect()
 	if err != nil {
-		log.Fatal("failed to connect database")
+		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	dbInstance := &DB{DB: db}
-
-	// Validate and create tables if needed
-	if err := dbInstance.ValidateTables(); err != nil {
-		log.Fatalf("Failed to validate/create tables: %v", err)
+	// Bring the schema up to date, refusing to start against a newer schema
+	if _, err := dbInstance.MigrateUp(context.Background(), 0); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
 	return dbInstance
@@ -76,16 +63,16 @@ func NewRepository(db *gorm.DB) model.Repository {
 
 // CreateCoupon creates a new coupon within a transaction
 func (db *DB) CreateCoupon(ctx context.Context, c *model.Coupon) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
 	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var existingCoupon model.Coupon
-		if err := tx.Where("code = ?", c.Code).First(&existingCoupon).Error; err == nil {
-			return fmt.Errorf("coupon code already exists")
+		if err := tx.Unscoped().Where("code = ?", c.Code).First(&existingCoupon).Error; err == nil {
+			return model.ErrCouponCodeExists
 		}
 
 		if err := tx.Create(c).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return model.ErrCouponCodeExists
+			}
 			return fmt.Errorf("failed to create coupon: %v", err)
 		}
 
@@ -94,9 +81,6 @@ func (db *DB) CreateCoupon(ctx context.Context, c *model.Coupon) error {
 }
 
 func (db *DB) GetAllCoupons(ctx context.Context) ([]*model.Coupon, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
 	var coupons []*model.Coupon
 	if err := db.WithContext(ctx).Find(&coupons).Error; err != nil {
 		return nil, err
@@ -105,9 +89,6 @@ func (db *DB) GetAllCoupons(ctx context.Context) ([]*model.Coupon, error) {
 }
 
 func (db *DB) FindCouponByCode(ctx context.Context, code string) (*model.Coupon, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
 	var coupon model.Coupon
 	if err := db.WithContext(ctx).Where("code = ?", code).First(&coupon).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -118,9 +99,680 @@ func (db *DB) FindCouponByCode(ctx context.Context, code string) (*model.Coupon,
 	return &coupon, nil
 }
 
+// UpdateCoupon saves the coupon's editable fields. The usage and reserved counts
+// are only changed by redemptions and reservations, so they are never overwritten.
 func (db *DB) UpdateCoupon(ctx context.Context, coupon *model.Coupon) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	return db.WithContext(ctx).Omit("usage_count", "reserved_count").Save(coupon).Error
+}
+
+func (db *DB) ListCoupons(ctx context.Context, filter *model.CouponFilter) ([]*model.Coupon, error) {
+	query, err := applyCouponFilter(db.WithContext(ctx).Order("id"), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var coupons []*model.Coupon
+	if err := query.Find(&coupons).Error; err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (db *DB) DeleteCoupon(ctx context.Context, coupon *model.Coupon) error {
+	return db.WithContext(ctx).Delete(coupon).Error
+}
+
+func (db *DB) FindRedemptionByOrderID(ctx context.Context, orderID string) (*model.Redemption, error) {
+	var redemption model.Redemption
+	if err := db.WithContext(ctx).Where("order_id = ?", orderID).First(&redemption).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// RedeemCoupon consumes one coupon use and records the redemption within a transaction
+func (db *DB) RedeemCoupon(ctx context.Context, r *model.Redemption) (*model.Redemption, error) {
+	var result *model.Redemption
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		existing, err := findRedemption(tx, r.OrderID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.CouponID != r.CouponID {
+				return model.ErrOrderRedeemed
+			}
+			result = existing
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if _, err := expireHolds(tx, now, r.CouponID); err != nil {
+			return err
+		}
+
+		// Claiming the use first locks the coupon row until the transaction ends,
+		// so concurrent redemptions of the coupon check customer limits in turn
+		if err := claimUse(tx, r.CouponID); err != nil {
+			return err
+		}
+
+		var coupon model.Coupon
+		if err := tx.First(&coupon, r.CouponID).Error; err != nil {
+			return err
+		}
+
+		if err := checkCustomerLimits(tx, &coupon, r.CustomerID, now); err != nil {
+			return err
+		}
+
+		r.Status = model.RedemptionStatusRedeemed
+		if err := tx.Create(r).Error; err != nil {
+			return fmt.Errorf("failed to create redemption: %v", err)
+		}
+
+		if err := appendLedgerEntry(tx, r, model.LedgerStatusRedeemed, r.Discount); err != nil {
+			return err
+		}
+
+		result = r
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// A concurrent request redeemed the order first
+		return db.redeemedOrder(ctx, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// redeemedOrder returns the order's existing redemption if it is for the same coupon
+func (db *DB) redeemedOrder(ctx context.Context, r *model.Redemption) (*model.Redemption, error) {
+	existing, err := findRedemption(db.WithContext(ctx), r.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil || existing.CouponID != r.CouponID {
+		return nil, model.ErrOrderRedeemed
+	}
+	return existing, nil
+}
+
+// ReserveCoupon holds one coupon use within a transaction
+func (db *DB) ReserveCoupon(ctx context.Context, r *model.Reservation) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		if _, err := expireHolds(tx, now, r.CouponID); err != nil {
+			return err
+		}
 
-	return db.WithContext(ctx).Save(coupon).Error
+		if err := claimHold(tx, r.CouponID); err != nil {
+			return err
+		}
+
+		var coupon model.Coupon
+		if err := tx.First(&coupon, r.CouponID).Error; err != nil {
+			return err
+		}
+
+		if err := checkCustomerLimits(tx, &coupon, r.CustomerID, now); err != nil {
+			return err
+		}
+
+		// Expiries are stored in UTC, which SQLite compares as text
+		r.ExpiresAt = r.ExpiresAt.UTC()
+		if err := tx.Create(r).Error; err != nil {
+			return fmt.Errorf("failed to create reservation: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// CommitReservation converts an active reservation into a redemption within a transaction
+func (db *DB) CommitReservation(ctx context.Context, id string, orderID string) (*model.Redemption, error) {
+	var result *model.Redemption
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reservation model.Reservation
+		if err := tx.Where("id = ?", id).First(&reservation).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return model.ErrReservationNotFound
+			}
+			return err
+		}
+
+		var existing model.Redemption
+		if err := tx.Where("order_id = ?", orderID).First(&existing).Error; err == nil {
+			if reservation.Status == model.ReservationStatusCommitted && reservation.OrderID == orderID {
+				result = &existing
+				return nil
+			}
+			return model.ErrOrderRedeemed
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		// Only one of concurrent commits, releases and expiries can move the reservation on
+		committed := tx.Model(&model.Reservation{}).
+			Where("id = ? AND status = ? AND expires_at > ?", id, model.ReservationStatusActive, time.Now().UTC()).
+			Updates(map[string]interface{}{
+				"status":   model.ReservationStatusCommitted,
+				"order_id": orderID,
+			})
+		if committed.Error != nil {
+			return fmt.Errorf("failed to commit reservation: %v", committed.Error)
+		}
+		if committed.RowsAffected == 0 {
+			return model.ErrReservationNotActive
+		}
+
+		// The held use becomes a redemption, so the limit was already checked
+		if err := tx.Model(&model.Coupon{}).Where("id = ?", reservation.CouponID).Updates(map[string]interface{}{
+			"usage_count":    gorm.Expr("usage_count + 1"),
+			"reserved_count": gorm.Expr("reserved_count - 1"),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update usage count: %v", err)
+		}
+
+		redemption := &model.Redemption{
+			CouponID:   reservation.CouponID,
+			CouponCode: reservation.CouponCode,
+			OrderID:    orderID,
+			CustomerID: reservation.CustomerID,
+			Currency:   reservation.Currency,
+			OrderTotal: reservation.OrderTotal,
+			Discount:   reservation.Discount,
+			Status:     model.RedemptionStatusRedeemed,
+		}
+		if err := tx.Create(redemption).Error; err != nil {
+			return fmt.Errorf("failed to create redemption: %v", err)
+		}
+
+		if err := appendLedgerEntry(tx, redemption, model.LedgerStatusRedeemed, redemption.Discount); err != nil {
+			return err
+		}
+
+		result = redemption
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, model.ErrOrderRedeemed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReleaseReservation releases an active reservation. Releasing it again is a no-op.
+func (db *DB) ReleaseReservation(ctx context.Context, id string) (*model.Reservation, error) {
+	var reservation model.Reservation
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&reservation).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return model.ErrReservationNotFound
+			}
+			return err
+		}
+
+		switch reservation.Status {
+		case model.ReservationStatusReleased:
+			return nil
+		case model.ReservationStatusActive:
+		default:
+			return model.ErrReservationNotActive
+		}
+
+		released, err := endHold(tx, &reservation, model.ReservationStatusReleased)
+		if err != nil {
+			return err
+		}
+		if !released {
+			// A concurrent commit, release or expiry got there first
+			return tx.Where("id = ?", id).First(&reservation).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// ExpireReservations expires every active reservation past its expiry and gives
+// its held use back to the coupon
+func (db *DB) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	var expired int64
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		expired, err = expireHolds(tx, now.UTC(), 0)
+		return err
+	})
+	return expired, err
+}
+
+func (db *DB) CountActiveReservations(ctx context.Context, now time.Time, couponIDs ...uint) (map[uint]int, error) {
+	var rows []struct {
+		CouponID uint
+		Count    int
+	}
+
+	query := db.WithContext(ctx).Model(&model.Reservation{}).
+		Select("coupon_id, COUNT(*) AS count").
+		Where("status = ? AND expires_at > ?", model.ReservationStatusActive, now.UTC())
+	if len(couponIDs) > 0 {
+		query = query.Where("coupon_id IN ?", couponIDs)
+	}
+
+	if err := query.Group("coupon_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.CouponID] = row.Count
+	}
+	return counts, nil
+}
+
+func (db *DB) CountCustomerRedemptions(ctx context.Context, customerID string, couponIDs ...uint) (map[uint]int, error) {
+	var rows []struct {
+		CouponID uint
+		Count    int
+	}
+
+	query := db.WithContext(ctx).Model(&model.Redemption{}).
+		Select("coupon_id, COUNT(*) AS count").
+		Where("customer_id = ? AND status = ?", customerID, model.RedemptionStatusRedeemed)
+	if len(couponIDs) > 0 {
+		query = query.Where("coupon_id IN ?", couponIDs)
+	}
+
+	if err := query.Group("coupon_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.CouponID] = row.Count
+	}
+	return counts, nil
+}
+
+// ReverseRedemption reverses all or part of an order's redemption within a transaction
+func (db *DB) ReverseRedemption(ctx context.Context, orderID string, refundAmount model.Money, reactivate bool, rounding model.RoundingMode) (*model.Reversal, error) {
+	var reversal *model.Reversal
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Touch the row before reading it, so concurrent reversals of the order
+		// wait for each other and each one sees the amounts the last one left
+		touched := tx.Model(&model.Redemption{}).Where("order_id = ?", orderID).Update("updated_at", time.Now().UTC())
+		if touched.Error != nil {
+			return touched.Error
+		}
+		if touched.RowsAffected == 0 {
+			return model.ErrRedemptionNotFound
+		}
+
+		var redemption model.Redemption
+		if err := tx.Where("order_id = ?", orderID).First(&redemption).Error; err != nil {
+			return err
+		}
+
+		if redemption.Status == model.RedemptionStatusReversed {
+			return model.ErrRedemptionReversed
+		}
+
+		remaining := redemption.OrderTotal - redemption.RefundedAmount
+		full := refundAmount <= 0 || refundAmount >= remaining
+		if full {
+			refundAmount = max(remaining, 0)
+		}
+
+		clawback := redemption.Discount - redemption.ClawedBack
+		if !full && redemption.OrderTotal > 0 {
+			clawback = min(rounding.MulDiv(redemption.Discount, int64(refundAmount), int64(redemption.OrderTotal)), clawback)
+		}
+
+		redemption.RefundedAmount += refundAmount
+		redemption.ClawedBack += clawback
+		status := model.LedgerStatusPartiallyReversed
+		if full {
+			redemption.Status = model.RedemptionStatusReversed
+			status = model.LedgerStatusReversed
+		}
+
+		if err := tx.Save(&redemption).Error; err != nil {
+			return fmt.Errorf("failed to reverse redemption: %v", err)
+		}
+
+		if err := appendLedgerEntry(tx, &redemption, status, clawback); err != nil {
+			return err
+		}
+
+		reversal = &model.Reversal{
+			OrderID:      orderID,
+			CouponCode:   redemption.CouponCode,
+			RefundAmount: refundAmount,
+			Clawback:     clawback,
+			Full:         full,
+			Redemption:   &redemption,
+		}
+
+		if !full {
+			return nil
+		}
+
+		if err := tx.Model(&model.Coupon{}).Where("id = ? AND usage_count > 0", redemption.CouponID).
+			Update("usage_count", gorm.Expr("usage_count - 1")).Error; err != nil {
+			return fmt.Errorf("failed to update usage count: %v", err)
+		}
+
+		if reactivate {
+			result := tx.Model(&model.Coupon{}).Where("id = ? AND usage_limit = 1", redemption.CouponID).
+				Update("is_active", true)
+			if result.Error != nil {
+				return fmt.Errorf("failed to reactivate coupon: %v", result.Error)
+			}
+			reversal.Reactivated = result.RowsAffected > 0
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+func (db *DB) ListLedgerEntries(ctx context.Context, filter *model.LedgerFilter) ([]*model.LedgerEntry, error) {
+	query := db.WithContext(ctx).Order("id")
+	if filter.CouponCode != "" {
+		query = query.Where("coupon_code = ?", filter.CouponCode)
+	}
+	if filter.OrderID != "" {
+		query = query.Where("order_id = ?", filter.OrderID)
+	}
+	if filter.CustomerID != "" {
+		query = query.Where("customer_id = ?", filter.CustomerID)
+	}
+
+	var entries []*model.LedgerEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (db *DB) LedgerUsageCounts(ctx context.Context) (map[uint]int, error) {
+	return ledgerUsageCounts(db.WithContext(ctx))
+}
+
+func (db *DB) SyncUsageCount(ctx context.Context, couponID uint) (int, error) {
+	var count int
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Every redemption and full reversal updates the coupon row in the
+		// transaction that writes its ledger entry, so holding the row keeps the
+		// ledger count current until the usage count is set
+		var coupon model.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, couponID).Error; err != nil {
+			return err
+		}
+
+		counts, err := ledgerUsageCounts(tx, couponID)
+		if err != nil {
+			return err
+		}
+		count = counts[couponID]
+
+		return tx.Model(&model.Coupon{}).Where("id = ?", couponID).Update("usage_count", count).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db *DB) SaveExchangeRates(ctx context.Context, rates []*model.ExchangeRate) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, rate := range rates {
+			// Saving the same rate again, such as when a rate file is reloaded,
+			// returns the recorded one
+			var existing model.ExchangeRate
+			err := tx.Where("base_currency = ? AND quote_currency = ? AND effective_at = ? AND rate = ?",
+				rate.BaseCurrency, rate.QuoteCurrency, rate.EffectiveAt, rate.Rate).
+				First(&existing).Error
+			if err == nil {
+				*rate = existing
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if err := tx.Create(rate).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DB) ListExchangeRates(ctx context.Context, at time.Time) ([]*model.ExchangeRate, error) {
+	// A rate is current unless a later one for its pair is already in effect.
+	// Rates taking effect at the same time are ordered by when they were saved.
+	// Times are stored in UTC and compared as such.
+	at = at.UTC()
+	var rates []*model.ExchangeRate
+	if err := db.WithContext(ctx).
+		Where("effective_at <= ?", at).
+		Where(`NOT EXISTS (SELECT 1 FROM exchange_rates later
+			WHERE later.base_currency = exchange_rates.base_currency
+			AND later.quote_currency = exchange_rates.quote_currency
+			AND later.effective_at <= ?
+			AND (later.effective_at > exchange_rates.effective_at
+				OR (later.effective_at = exchange_rates.effective_at AND later.id > exchange_rates.id)))`, at).
+		Order("base_currency, quote_currency").
+		Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (db *DB) NextExchangeRateAt(ctx context.Context, after time.Time) (time.Time, error) {
+	var rate model.ExchangeRate
+	err := db.WithContext(ctx).Where("effective_at > ?", after.UTC()).Order("effective_at").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rate.EffectiveAt, nil
+}
+
+// findRedemption returns the order's redemption, or nil if it has none
+func findRedemption(tx *gorm.DB, orderID string) (*model.Redemption, error) {
+	var redemption model.Redemption
+	if err := tx.Where("order_id = ?", orderID).First(&redemption).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// claimUse counts one use against the coupon's limit, failing if the uses and
+// active holds already reach it. The check and the increment are one statement,
+// so concurrent claims can never exceed the limit.
+func claimUse(tx *gorm.DB, couponID uint) error {
+	result := tx.Model(&model.Coupon{}).
+		Where("id = ? AND usage_count + reserved_count < usage_limit", couponID).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to update usage count: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrUsageLimitReached
+	}
+	return nil
+}
+
+// claimHold holds one use of the coupon, failing like claimUse at the limit
+func claimHold(tx *gorm.DB, couponID uint) error {
+	result := tx.Model(&model.Coupon{}).
+		Where("id = ? AND usage_count + reserved_count < usage_limit", couponID).
+		Update("reserved_count", gorm.Expr("reserved_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to hold coupon use: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrUsageLimitReached
+	}
+	return nil
+}
+
+// endHold moves an active reservation to the given status and gives its held use
+// back. It reports false if the reservation was no longer active.
+func endHold(tx *gorm.DB, reservation *model.Reservation, status string) (bool, error) {
+	result := tx.Model(&model.Reservation{}).
+		Where("id = ? AND status = ?", reservation.ID, model.ReservationStatusActive).
+		Update("status", status)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update reservation: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := tx.Model(&model.Coupon{}).Where("id = ? AND reserved_count > 0", reservation.CouponID).
+		Update("reserved_count", gorm.Expr("reserved_count - 1")).Error; err != nil {
+		return false, fmt.Errorf("failed to release coupon use: %v", err)
+	}
+
+	reservation.Status = status
+	return true, nil
+}
+
+// expireHolds expires the active reservations past their expiry, only those of
+// the coupon when couponID is set, and returns how many it expired
+func expireHolds(tx *gorm.DB, now time.Time, couponID uint) (int64, error) {
+	query := tx.Where("status = ? AND expires_at <= ?", model.ReservationStatusActive, now)
+	if couponID != 0 {
+		query = query.Where("coupon_id = ?", couponID)
+	}
+
+	var stale []*model.Reservation
+	if err := query.Find(&stale).Error; err != nil {
+		return 0, err
+	}
+
+	var expired int64
+	for _, reservation := range stale {
+		ended, err := endHold(tx, reservation, model.ReservationStatusExpired)
+		if err != nil {
+			return expired, err
+		}
+		if ended {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// ledgerUsageCounts returns the net number of redemptions per coupon recorded in
+// the ledger. With coupon IDs it counts only those coupons.
+func ledgerUsageCounts(tx *gorm.DB, couponIDs ...uint) (map[uint]int, error) {
+	var rows []struct {
+		CouponID uint
+		Status   string
+		Count    int
+	}
+
+	query := tx.Model(&model.LedgerEntry{}).
+		Select("coupon_id, status, COUNT(*) AS count").
+		Where("status IN ?", []string{model.LedgerStatusRedeemed, model.LedgerStatusReversed})
+	if len(couponIDs) > 0 {
+		query = query.Where("coupon_id IN ?", couponIDs)
+	}
+
+	if err := query.Group("coupon_id, status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int)
+	for _, row := range rows {
+		if row.Status == model.LedgerStatusReversed {
+			counts[row.CouponID] -= row.Count
+		} else {
+			counts[row.CouponID] += row.Count
+		}
+	}
+	return counts, nil
+}
+
+// appendLedgerEntry records a redemption event in the ledger
+func appendLedgerEntry(tx *gorm.DB, r *model.Redemption, status string, amount model.Money) error {
+	entry := &model.LedgerEntry{
+		CouponID:   r.CouponID,
+		CouponCode: r.CouponCode,
+		OrderID:    r.OrderID,
+		CustomerID: r.CustomerID,
+		Currency:   r.Currency,
+		Amount:     amount,
+		Status:     status,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to append ledger entry: %v", err)
+	}
+	return nil
+}
+
+// checkCustomerLimits enforces the coupon's per-customer and first-order rules,
+// counting the customer's redemptions and active holds
+func checkCustomerLimits(tx *gorm.DB, coupon *model.Coupon, customerID string, now time.Time) error {
+	if coupon.PerCustomerLimit == 0 && !coupon.FirstOrderOnly {
+		return nil
+	}
+
+	if customerID == "" {
+		return model.ErrCustomerRequired
+	}
+
+	if coupon.PerCustomerLimit > 0 {
+		var redeemed, held int64
+		if err := tx.Model(&model.Redemption{}).
+			Where("coupon_id = ? AND customer_id = ? AND status = ?", coupon.ID, customerID, model.RedemptionStatusRedeemed).
+			Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Reservation{}).
+			Where("coupon_id = ? AND customer_id = ? AND status = ? AND expires_at > ?",
+				coupon.ID, customerID, model.ReservationStatusActive, now).
+			Count(&held).Error; err != nil {
+			return err
+		}
+		if int(redeemed+held) >= coupon.PerCustomerLimit {
+			return model.ErrCustomerLimitReached
+		}
+	}
+
+	if coupon.FirstOrderOnly {
+		var orders int64
+		if err := tx.Model(&model.Redemption{}).
+			Where("customer_id = ? AND status = ?", customerID, model.RedemptionStatusRedeemed).
+			Count(&orders).Error; err != nil {
+			return err
+		}
+		if orders > 0 {
+			return model.ErrNotFirstOrder
+		}
+	}
+
+	return nil
 }
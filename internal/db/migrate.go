@@ -0,0 +1,407 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	ErrSchemaAhead      = errors.New("database schema is ahead of this binary")
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+)
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the up SQL so edits to an applied migration are detected
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	Checksum  string `gorm:"size:64"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus reports whether a migration has been applied. Unknown marks a
+// migration recorded in the database that this binary does not ship.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+// loadMigrations reads the migrations shipped for the given dialect in version order
+func loadMigrations(dialect string) ([]*Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %s: %v", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a migration script into statements, dropping comment lines
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Migrations returns the migrations this binary ships for the connected database
+func (db *DB) Migrations() ([]*Migration, error) {
+	return loadMigrations(db.Dialector.Name())
+}
+
+// appliedMigrations returns the recorded migrations, creating the bookkeeping table if needed
+func (db *DB) appliedMigrations(ctx context.Context) (map[int]SchemaMigration, error) {
+	if err := db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	var records []SchemaMigration
+	if err := db.WithContext(ctx).Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// verifySchema ensures every applied migration is known to this binary and unchanged
+func verifySchema(migrations []*Migration, applied map[int]SchemaMigration) error {
+	known := make(map[int]*Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	for _, version := range versions {
+		record := applied[version]
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: migration %04d_%s is not known", ErrSchemaAhead, record.Version, record.Name)
+		}
+		if m.Checksum() != record.Checksum {
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// CheckSchema fails if the database has migrations this binary does not ship
+// or if an applied migration was edited after it ran
+func (db *DB) CheckSchema(ctx context.Context) error {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	return verifySchema(migrations, applied)
+}
+
+// migrationLockKey identifies the lock held while migrations run, shared by
+// every replica of the service
+const migrationLockKey = "coupon_system_schema_migrations"
+
+// withMigrationLock runs fn while holding a database-wide lock, so replicas
+// starting at the same time apply migrations one after another. PostgreSQL and
+// MySQL take a session lock on a dedicated connection that fn then uses. SQLite
+// runs fn in one immediate transaction, which holds the write lock throughout;
+// each migration becomes a savepoint within it.
+func (db *DB) withMigrationLock(ctx context.Context, fn func(locked *DB) error) error {
+	name := db.Dialector.Name()
+	if name == "sqlite" {
+		var runErr error
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Keep migrations applied before a failure, as separate runs would
+			runErr = fn(&DB{DB: tx})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return runErr
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch name {
+	case "postgres":
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLockKey); err != nil {
+			return fmt.Errorf("failed to take migration lock: %v", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", migrationLockKey)
+	case "mysql":
+		var acquired sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", migrationLockKey).Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to take migration lock: %v", err)
+		}
+		if acquired.Int64 != 1 {
+			return errors.New("failed to take migration lock")
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockKey)
+	default:
+		return fmt.Errorf("no migration lock for dialect %s", name)
+	}
+
+	session := db.Session(&gorm.Session{Context: ctx})
+	session.Statement.ConnPool = conn
+	return fn(&DB{DB: session})
+}
+
+// MigrateUp applies pending migrations up to and including target, or all of
+// them when target is 0, and returns how many were applied
+func (db *DB) MigrateUp(ctx context.Context, target int) (int, error) {
+	count := 0
+	err := db.withMigrationLock(ctx, func(locked *DB) error {
+		var err error
+		count, err = locked.migrateUp(ctx, target)
+		return err
+	})
+	return count, err
+}
+
+func (db *DB) migrateUp(ctx context.Context, target int) (int, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifySchema(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, statement := range splitStatements(m.Up) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				Checksum:  m.Checksum(),
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, at most steps of
+// them, and returns how many were reverted
+func (db *DB) MigrateDown(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := db.withMigrationLock(ctx, func(locked *DB) error {
+		var err error
+		count, err = locked.migrateDown(ctx, steps)
+		return err
+	})
+	return count, err
+}
+
+func (db *DB) migrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifySchema(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, statement := range splitStatements(m.Down) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("reverting migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+
+		log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus lists shipped and recorded migrations in version order
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
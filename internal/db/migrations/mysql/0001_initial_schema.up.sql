@@ -0,0 +1,21 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created by the old
+-- drop-and-recreate startup are adopted without losing their rows. MySQL has
+-- no CREATE INDEX IF NOT EXISTS, so indexes are declared with their tables.
+CREATE TABLE IF NOT EXISTS `coupons` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `code` varchar(191),
+    `discount_type` longtext,
+    `discount_value` double,
+    `min_order_value` double,
+    `max_discount` double,
+    `start_date` datetime(3) NULL,
+    `end_date` datetime(3) NULL,
+    `usage_limit` bigint,
+    `usage_count` bigint,
+    `is_active` boolean,
+    `applicable_items` text,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_coupons_code` (`code`)
+);
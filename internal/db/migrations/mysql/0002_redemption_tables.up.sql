@@ -0,0 +1,53 @@
+-- Redemptions, reservation holds and the append-only redemption ledger.
+CREATE TABLE IF NOT EXISTS `redemptions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `coupon_id` bigint unsigned,
+    `coupon_code` longtext,
+    `order_id` varchar(191),
+    `customer_id` varchar(191),
+    `order_total` double,
+    `discount` double,
+    `status` longtext,
+    `refunded_amount` double,
+    `clawed_back` double,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_redemptions_order_id` (`order_id`),
+    INDEX `idx_redemptions_coupon_id` (`coupon_id`),
+    INDEX `idx_redemptions_customer_id` (`customer_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `reservations` (
+    `id` varchar(191),
+    `coupon_id` bigint unsigned,
+    `coupon_code` longtext,
+    `order_id` longtext,
+    `customer_id` varchar(191),
+    `order_total` double,
+    `discount` double,
+    `status` varchar(191),
+    `expires_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_reservations_coupon_id` (`coupon_id`),
+    INDEX `idx_reservations_customer_id` (`customer_id`),
+    INDEX `idx_reservations_status` (`status`),
+    INDEX `idx_reservations_expires_at` (`expires_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `redemption_ledger` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `coupon_id` bigint unsigned,
+    `coupon_code` longtext,
+    `order_id` varchar(191),
+    `customer_id` varchar(191),
+    `amount` double,
+    `status` longtext,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_redemption_ledger_coupon_id` (`coupon_id`),
+    INDEX `idx_redemption_ledger_order_id` (`order_id`),
+    INDEX `idx_redemption_ledger_customer_id` (`customer_id`)
+);
@@ -0,0 +1,3 @@
+-- Soft delete: deleted coupons keep their row so redemptions still resolve.
+ALTER TABLE `coupons` ADD COLUMN `deleted_at` datetime(3) NULL;
+CREATE INDEX `idx_coupons_deleted_at` ON `coupons` (`deleted_at`);
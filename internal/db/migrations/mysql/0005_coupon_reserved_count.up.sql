@@ -0,0 +1,7 @@
+-- Active holds are counted on the coupon row so that the usage limit can be
+-- enforced by a single conditional update.
+ALTER TABLE `coupons` ADD COLUMN `reserved_count` bigint NOT NULL DEFAULT 0;
+UPDATE `coupons` SET `reserved_count` = (
+    SELECT COUNT(*) FROM `reservations`
+    WHERE `reservations`.`coupon_id` = `coupons`.`id` AND `reservations`.`status` = 'active'
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `coupons` DROP COLUMN `priority`;
+ALTER TABLE `coupons` DROP COLUMN `stack_group`;
+ALTER TABLE `coupons` DROP COLUMN `exclusive`;
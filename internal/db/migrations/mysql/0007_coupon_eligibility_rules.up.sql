@@ -0,0 +1,7 @@
+-- Eligibility rules narrow the cart items a coupon applies to by category,
+-- brand and sale status. The lists are stored as JSON arrays like applicable_items.
+ALTER TABLE `coupons` ADD COLUMN `include_categories` text;
+ALTER TABLE `coupons` ADD COLUMN `exclude_categories` text;
+ALTER TABLE `coupons` ADD COLUMN `include_brands` text;
+ALTER TABLE `coupons` ADD COLUMN `exclude_brands` text;
+ALTER TABLE `coupons` ADD COLUMN `exclude_on_sale` boolean NOT NULL DEFAULT false;
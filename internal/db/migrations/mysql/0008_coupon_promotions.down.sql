@@ -0,0 +1,4 @@
+ALTER TABLE `coupons` DROP COLUMN `max_applications`;
+ALTER TABLE `coupons` DROP COLUMN `reward_items`;
+ALTER TABLE `coupons` DROP COLUMN `get_quantity`;
+ALTER TABLE `coupons` DROP COLUMN `buy_quantity`;
@@ -0,0 +1,2 @@
+-- Tiered coupons give the discount of the highest spend threshold reached.
+ALTER TABLE `coupons` ADD COLUMN `tiers` text;
@@ -0,0 +1,28 @@
+UPDATE `coupons` SET `tiers` = (
+    SELECT JSON_ARRAYAGG(JSON_OBJECT(
+        'min_spend', COALESCE(t.min_spend, 0) / 100,
+        'discount_type', t.discount_type,
+        'discount_value', IF(t.discount_type = 'flat', COALESCE(t.discount_amount, 0) / 100, COALESCE(t.discount_value, 0)),
+        'max_discount', COALESCE(t.max_discount, 0) / 100))
+    FROM JSON_TABLE(`coupons`.`tiers`, '$[*]' COLUMNS (
+        `min_spend` bigint PATH '$.min_spend',
+        `discount_type` varchar(32) PATH '$.discount_type',
+        `discount_value` double PATH '$.discount_value',
+        `discount_amount` bigint PATH '$.discount_amount',
+        `max_discount` bigint PATH '$.max_discount')) AS t)
+    WHERE `tiers` IS NOT NULL AND `tiers` NOT IN ('', 'null', '[]');
+ALTER TABLE `redemption_ledger` MODIFY COLUMN `amount` double;
+UPDATE `redemption_ledger` SET `amount` = `amount` / 100;
+ALTER TABLE `reservations` MODIFY COLUMN `discount` double, MODIFY COLUMN `order_total` double;
+UPDATE `reservations` SET `discount` = `discount` / 100, `order_total` = `order_total` / 100;
+ALTER TABLE `redemptions` MODIFY COLUMN `clawed_back` double, MODIFY COLUMN `refunded_amount` double, MODIFY COLUMN `discount` double, MODIFY COLUMN `order_total` double;
+UPDATE `redemptions` SET `clawed_back` = `clawed_back` / 100, `refunded_amount` = `refunded_amount` / 100, `discount` = `discount` / 100, `order_total` = `order_total` / 100;
+ALTER TABLE `coupons` MODIFY COLUMN `max_discount` double, MODIFY COLUMN `min_order_value` double;
+UPDATE `coupons` SET `max_discount` = `max_discount` / 100, `min_order_value` = `min_order_value` / 100;
+ALTER TABLE `redemption_ledger` DROP COLUMN `currency`;
+ALTER TABLE `reservations` DROP COLUMN `currency`;
+ALTER TABLE `redemptions` DROP COLUMN `currency`;
+ALTER TABLE `coupons` DROP COLUMN `prices`;
+ALTER TABLE `coupons` DROP COLUMN `currency`;
+UPDATE `coupons` SET `discount_value` = `discount_amount` / 100 WHERE `discount_type` IN ('flat', 'shipping_flat');
+ALTER TABLE `coupons` DROP COLUMN `discount_amount`;
@@ -0,0 +1,42 @@
+-- Amounts become integer minor units with a currency. Existing amounts were
+-- in major units of the default currency, USD, and are multiplied by 100.
+
+ALTER TABLE `coupons` ADD COLUMN `discount_amount` bigint NOT NULL DEFAULT 0;
+-- MySQL assigns left to right, so discount_amount reads discount_value before it is cleared
+UPDATE `coupons` SET `discount_amount` = ROUND(COALESCE(`discount_value`, 0) * 100), `discount_value` = 0
+    WHERE `discount_type` IN ('flat', 'shipping_flat');
+ALTER TABLE `coupons` ADD COLUMN `currency` varchar(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE `coupons` ADD COLUMN `prices` text;
+ALTER TABLE `redemptions` ADD COLUMN `currency` varchar(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE `reservations` ADD COLUMN `currency` varchar(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE `redemption_ledger` ADD COLUMN `currency` varchar(3) NOT NULL DEFAULT 'USD';
+
+UPDATE `coupons` SET `min_order_value` = ROUND(COALESCE(`min_order_value`, 0) * 100), `max_discount` = ROUND(COALESCE(`max_discount`, 0) * 100);
+ALTER TABLE `coupons` MODIFY COLUMN `min_order_value` bigint NOT NULL DEFAULT 0, MODIFY COLUMN `max_discount` bigint NOT NULL DEFAULT 0;
+UPDATE `redemptions` SET `order_total` = ROUND(COALESCE(`order_total`, 0) * 100), `discount` = ROUND(COALESCE(`discount`, 0) * 100), `refunded_amount` = ROUND(COALESCE(`refunded_amount`, 0) * 100), `clawed_back` = ROUND(COALESCE(`clawed_back`, 0) * 100);
+ALTER TABLE `redemptions` MODIFY COLUMN `order_total` bigint NOT NULL DEFAULT 0, MODIFY COLUMN `discount` bigint NOT NULL DEFAULT 0, MODIFY COLUMN `refunded_amount` bigint NOT NULL DEFAULT 0, MODIFY COLUMN `clawed_back` bigint NOT NULL DEFAULT 0;
+UPDATE `reservations` SET `order_total` = ROUND(COALESCE(`order_total`, 0) * 100), `discount` = ROUND(COALESCE(`discount`, 0) * 100);
+ALTER TABLE `reservations` MODIFY COLUMN `order_total` bigint NOT NULL DEFAULT 0, MODIFY COLUMN `discount` bigint NOT NULL DEFAULT 0;
+UPDATE `redemption_ledger` SET `amount` = ROUND(COALESCE(`amount`, 0) * 100);
+ALTER TABLE `redemption_ledger` MODIFY COLUMN `amount` bigint NOT NULL DEFAULT 0;
+
+-- Tier amounts are stored in the tiers JSON, and flat tiers move their value to discount_amount.
+-- JSON_ARRAYAGG takes no ORDER BY, so the tiers are aggregated from a derived table sorted
+-- by their position; the LIMIT keeps MySQL from merging it and dropping the sort.
+UPDATE `coupons` SET `tiers` = (
+    SELECT JSON_ARRAYAGG(JSON_OBJECT(
+        'min_spend', CAST(ROUND(COALESCE(t.min_spend, 0) * 100) AS SIGNED),
+        'discount_type', t.discount_type,
+        'discount_value', IF(t.discount_type = 'flat', 0, COALESCE(t.discount_value, 0)),
+        'discount_amount', IF(t.discount_type = 'flat', CAST(ROUND(COALESCE(t.discount_value, 0) * 100) AS SIGNED), 0),
+        'max_discount', CAST(ROUND(COALESCE(t.max_discount, 0) * 100) AS SIGNED)))
+    FROM (
+        SELECT j.* FROM JSON_TABLE(`coupons`.`tiers`, '$[*]' COLUMNS (
+            `n` FOR ORDINALITY,
+            `min_spend` double PATH '$.min_spend',
+            `discount_type` varchar(32) PATH '$.discount_type',
+            `discount_value` double PATH '$.discount_value',
+            `max_discount` double PATH '$.max_discount')) AS j
+        ORDER BY j.n
+        LIMIT 18446744073709551615) AS t)
+    WHERE `tiers` IS NOT NULL AND `tiers` NOT IN ('', 'null', '[]');
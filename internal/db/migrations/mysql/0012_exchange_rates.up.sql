@@ -0,0 +1,12 @@
+-- Exchange rates convert coupon amounts into the currency of a cart. Each pair
+-- keeps its history, and a rate applies from its effective time onwards.
+CREATE TABLE IF NOT EXISTS `exchange_rates` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `base_currency` varchar(3),
+    `quote_currency` varchar(3),
+    `rate` double,
+    `effective_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_exchange_rates_pair` (`base_currency`,`quote_currency`,`effective_at`)
+);
@@ -0,0 +1 @@
+-- The converted dates are the same instants, so there is nothing to revert.
@@ -0,0 +1,2 @@
+-- Coupon dates are stored in UTC so they compare correctly as text on SQLite.
+-- This database compares dates as instants, so there is nothing to convert.
@@ -0,0 +1,19 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created by the old
+-- drop-and-recreate startup are adopted without losing their rows.
+CREATE TABLE IF NOT EXISTS coupons (
+    id bigserial PRIMARY KEY,
+    code text,
+    discount_type text,
+    discount_value decimal,
+    min_order_value decimal,
+    max_discount decimal,
+    start_date timestamptz,
+    end_date timestamptz,
+    usage_limit bigint,
+    usage_count bigint,
+    is_active boolean,
+    applicable_items text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_coupons_code ON coupons (code);
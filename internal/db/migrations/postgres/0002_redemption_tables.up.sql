@@ -0,0 +1,50 @@
+-- Redemptions, reservation holds and the append-only redemption ledger.
+CREATE TABLE IF NOT EXISTS redemptions (
+    id bigserial PRIMARY KEY,
+    coupon_id bigint,
+    coupon_code text,
+    order_id text,
+    customer_id text,
+    order_total decimal,
+    discount decimal,
+    status text,
+    refunded_amount decimal,
+    clawed_back decimal,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_redemptions_order_id ON redemptions (order_id);
+CREATE INDEX IF NOT EXISTS idx_redemptions_coupon_id ON redemptions (coupon_id);
+CREATE INDEX IF NOT EXISTS idx_redemptions_customer_id ON redemptions (customer_id);
+
+CREATE TABLE IF NOT EXISTS reservations (
+    id text PRIMARY KEY,
+    coupon_id bigint,
+    coupon_code text,
+    order_id text,
+    customer_id text,
+    order_total decimal,
+    discount decimal,
+    status text,
+    expires_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_reservations_coupon_id ON reservations (coupon_id);
+CREATE INDEX IF NOT EXISTS idx_reservations_customer_id ON reservations (customer_id);
+CREATE INDEX IF NOT EXISTS idx_reservations_status ON reservations (status);
+CREATE INDEX IF NOT EXISTS idx_reservations_expires_at ON reservations (expires_at);
+
+CREATE TABLE IF NOT EXISTS redemption_ledger (
+    id bigserial PRIMARY KEY,
+    coupon_id bigint,
+    coupon_code text,
+    order_id text,
+    customer_id text,
+    amount decimal,
+    status text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_redemption_ledger_coupon_id ON redemption_ledger (coupon_id);
+CREATE INDEX IF NOT EXISTS idx_redemption_ledger_order_id ON redemption_ledger (order_id);
+CREATE INDEX IF NOT EXISTS idx_redemption_ledger_customer_id ON redemption_ledger (customer_id);
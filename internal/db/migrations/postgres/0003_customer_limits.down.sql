@@ -0,0 +1,2 @@
+ALTER TABLE coupons DROP COLUMN first_order_only;
+ALTER TABLE coupons DROP COLUMN per_customer_limit;
@@ -0,0 +1,4 @@
+-- Stacking rules decide which coupons can be combined on one cart.
+ALTER TABLE coupons ADD COLUMN exclusive boolean NOT NULL DEFAULT false;
+ALTER TABLE coupons ADD COLUMN stack_group text NOT NULL DEFAULT '';
+ALTER TABLE coupons ADD COLUMN priority bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Shipping discounts can be limited to some shipping methods.
+ALTER TABLE coupons ADD COLUMN shipping_methods text;
@@ -0,0 +1,30 @@
+UPDATE coupons SET tiers = (
+    SELECT json_agg(json_build_object(
+        'min_spend', COALESCE((t.tier->>'min_spend')::numeric, 0) / 100,
+        'discount_type', t.tier->>'discount_type',
+        'discount_value', CASE WHEN t.tier->>'discount_type' = 'flat'
+            THEN COALESCE((t.tier->>'discount_amount')::numeric, 0) / 100
+            ELSE COALESCE((t.tier->>'discount_value')::numeric, 0) END,
+        'max_discount', COALESCE((t.tier->>'max_discount')::numeric, 0) / 100) ORDER BY t.n)::text
+    FROM json_array_elements(tiers::json) WITH ORDINALITY AS t(tier, n))
+    WHERE tiers IS NOT NULL AND tiers NOT IN ('', 'null', '[]');
+ALTER TABLE redemption_ledger
+    ALTER COLUMN amount TYPE decimal USING amount / 100.0;
+ALTER TABLE reservations
+    ALTER COLUMN discount TYPE decimal USING discount / 100.0,
+    ALTER COLUMN order_total TYPE decimal USING order_total / 100.0;
+ALTER TABLE redemptions
+    ALTER COLUMN clawed_back TYPE decimal USING clawed_back / 100.0,
+    ALTER COLUMN refunded_amount TYPE decimal USING refunded_amount / 100.0,
+    ALTER COLUMN discount TYPE decimal USING discount / 100.0,
+    ALTER COLUMN order_total TYPE decimal USING order_total / 100.0;
+ALTER TABLE coupons
+    ALTER COLUMN max_discount TYPE decimal USING max_discount / 100.0,
+    ALTER COLUMN min_order_value TYPE decimal USING min_order_value / 100.0;
+ALTER TABLE redemption_ledger DROP COLUMN currency;
+ALTER TABLE reservations DROP COLUMN currency;
+ALTER TABLE redemptions DROP COLUMN currency;
+ALTER TABLE coupons DROP COLUMN prices;
+ALTER TABLE coupons DROP COLUMN currency;
+UPDATE coupons SET discount_value = discount_amount / 100.0 WHERE discount_type IN ('flat', 'shipping_flat');
+ALTER TABLE coupons DROP COLUMN discount_amount;
@@ -0,0 +1,38 @@
+-- Amounts become integer minor units with a currency. Existing amounts were
+-- in major units of the default currency, USD, and are multiplied by 100.
+
+ALTER TABLE coupons ADD COLUMN discount_amount bigint NOT NULL DEFAULT 0;
+UPDATE coupons SET discount_amount = round(COALESCE(discount_value, 0) * 100), discount_value = 0
+    WHERE discount_type IN ('flat', 'shipping_flat');
+ALTER TABLE coupons ADD COLUMN currency text NOT NULL DEFAULT 'USD';
+ALTER TABLE coupons ADD COLUMN prices text;
+ALTER TABLE redemptions ADD COLUMN currency text NOT NULL DEFAULT 'USD';
+ALTER TABLE reservations ADD COLUMN currency text NOT NULL DEFAULT 'USD';
+ALTER TABLE redemption_ledger ADD COLUMN currency text NOT NULL DEFAULT 'USD';
+
+ALTER TABLE coupons
+    ALTER COLUMN min_order_value TYPE bigint USING round(COALESCE(min_order_value, 0) * 100),
+    ALTER COLUMN max_discount TYPE bigint USING round(COALESCE(max_discount, 0) * 100);
+ALTER TABLE redemptions
+    ALTER COLUMN order_total TYPE bigint USING round(COALESCE(order_total, 0) * 100),
+    ALTER COLUMN discount TYPE bigint USING round(COALESCE(discount, 0) * 100),
+    ALTER COLUMN refunded_amount TYPE bigint USING round(COALESCE(refunded_amount, 0) * 100),
+    ALTER COLUMN clawed_back TYPE bigint USING round(COALESCE(clawed_back, 0) * 100);
+ALTER TABLE reservations
+    ALTER COLUMN order_total TYPE bigint USING round(COALESCE(order_total, 0) * 100),
+    ALTER COLUMN discount TYPE bigint USING round(COALESCE(discount, 0) * 100);
+ALTER TABLE redemption_ledger
+    ALTER COLUMN amount TYPE bigint USING round(COALESCE(amount, 0) * 100);
+
+-- Tier amounts are stored in the tiers JSON, and flat tiers move their value to discount_amount
+UPDATE coupons SET tiers = (
+    SELECT json_agg(json_build_object(
+        'min_spend', round(COALESCE((t.tier->>'min_spend')::numeric, 0) * 100)::bigint,
+        'discount_type', t.tier->>'discount_type',
+        'discount_value', CASE WHEN t.tier->>'discount_type' = 'flat' THEN 0
+            ELSE COALESCE((t.tier->>'discount_value')::numeric, 0) END,
+        'discount_amount', CASE WHEN t.tier->>'discount_type' = 'flat'
+            THEN round(COALESCE((t.tier->>'discount_value')::numeric, 0) * 100)::bigint ELSE 0 END,
+        'max_discount', round(COALESCE((t.tier->>'max_discount')::numeric, 0) * 100)::bigint) ORDER BY t.n)::text
+    FROM json_array_elements(tiers::json) WITH ORDINALITY AS t(tier, n))
+    WHERE tiers IS NOT NULL AND tiers NOT IN ('', 'null', '[]');
@@ -0,0 +1,11 @@
+-- Exchange rates convert coupon amounts into the currency of a cart. Each pair
+-- keeps its history, and a rate applies from its effective time onwards.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id bigserial PRIMARY KEY,
+    base_currency text,
+    quote_currency text,
+    rate decimal,
+    effective_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair ON exchange_rates (base_currency, quote_currency, effective_at);
@@ -0,0 +1,2 @@
+-- Coupons can carry a rule expression the cart must satisfy.
+ALTER TABLE coupons ADD COLUMN rule text;
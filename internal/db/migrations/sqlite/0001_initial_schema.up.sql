@@ -0,0 +1,19 @@
+-- Baseline schema, exactly as the original drop-and-recreate startup created
+-- it. Uses IF NOT EXISTS so those databases are adopted without losing rows.
+CREATE TABLE IF NOT EXISTS `coupons` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `code` text,
+    `discount_type` text,
+    `discount_value` real,
+    `min_order_value` real,
+    `max_discount` real,
+    `start_date` datetime,
+    `end_date` datetime,
+    `usage_limit` integer,
+    `usage_count` integer,
+    `is_active` numeric,
+    `applicable_items` text,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_coupons_code` ON `coupons`(`code`);
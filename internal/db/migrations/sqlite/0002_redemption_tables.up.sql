@@ -0,0 +1,51 @@
+-- Redemptions, reservation holds and the append-only redemption ledger.
+CREATE TABLE IF NOT EXISTS `redemptions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `coupon_id` integer,
+    `coupon_code` text,
+    `order_id` text,
+    `customer_id` text,
+    `order_total` real,
+    `discount` real,
+    `status` text,
+    `refunded_amount` real,
+    `clawed_back` real,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_redemptions_order_id` ON `redemptions`(`order_id`);
+CREATE INDEX IF NOT EXISTS `idx_redemptions_coupon_id` ON `redemptions`(`coupon_id`);
+CREATE INDEX IF NOT EXISTS `idx_redemptions_customer_id` ON `redemptions`(`customer_id`);
+
+CREATE TABLE IF NOT EXISTS `reservations` (
+    `id` text,
+    `coupon_id` integer,
+    `coupon_code` text,
+    `order_id` text,
+    `customer_id` text,
+    `order_total` real,
+    `discount` real,
+    `status` text,
+    `expires_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_reservations_coupon_id` ON `reservations`(`coupon_id`);
+CREATE INDEX IF NOT EXISTS `idx_reservations_customer_id` ON `reservations`(`customer_id`);
+CREATE INDEX IF NOT EXISTS `idx_reservations_status` ON `reservations`(`status`);
+CREATE INDEX IF NOT EXISTS `idx_reservations_expires_at` ON `reservations`(`expires_at`);
+
+CREATE TABLE IF NOT EXISTS `redemption_ledger` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `coupon_id` integer,
+    `coupon_code` text,
+    `order_id` text,
+    `customer_id` text,
+    `amount` real,
+    `status` text,
+    `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_redemption_ledger_coupon_id` ON `redemption_ledger`(`coupon_id`);
+CREATE INDEX IF NOT EXISTS `idx_redemption_ledger_order_id` ON `redemption_ledger`(`order_id`);
+CREATE INDEX IF NOT EXISTS `idx_redemption_ledger_customer_id` ON `redemption_ledger`(`customer_id`);
@@ -0,0 +1,3 @@
+-- Per-customer usage limits and first-order-only coupons.
+ALTER TABLE `coupons` ADD COLUMN `per_customer_limit` integer;
+ALTER TABLE `coupons` ADD COLUMN `first_order_only` numeric;
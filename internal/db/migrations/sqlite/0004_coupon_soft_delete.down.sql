@@ -0,0 +1,2 @@
+DROP INDEX `idx_coupons_deleted_at`;
+ALTER TABLE `coupons` DROP COLUMN `deleted_at`;
@@ -0,0 +1,4 @@
+-- Stacking rules decide which coupons can be combined on one cart.
+ALTER TABLE `coupons` ADD COLUMN `exclusive` numeric NOT NULL DEFAULT 0;
+ALTER TABLE `coupons` ADD COLUMN `stack_group` text NOT NULL DEFAULT '';
+ALTER TABLE `coupons` ADD COLUMN `priority` integer NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE `coupons` DROP COLUMN `exclude_on_sale`;
+ALTER TABLE `coupons` DROP COLUMN `exclude_brands`;
+ALTER TABLE `coupons` DROP COLUMN `include_brands`;
+ALTER TABLE `coupons` DROP COLUMN `exclude_categories`;
+ALTER TABLE `coupons` DROP COLUMN `include_categories`;
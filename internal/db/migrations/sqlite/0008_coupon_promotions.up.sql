@@ -0,0 +1,5 @@
+-- Buy-X-get-Y and cheapest-free promotions count units of the cart lines.
+ALTER TABLE `coupons` ADD COLUMN `buy_quantity` integer NOT NULL DEFAULT 0;
+ALTER TABLE `coupons` ADD COLUMN `get_quantity` integer NOT NULL DEFAULT 0;
+ALTER TABLE `coupons` ADD COLUMN `reward_items` text;
+ALTER TABLE `coupons` ADD COLUMN `max_applications` integer NOT NULL DEFAULT 0;
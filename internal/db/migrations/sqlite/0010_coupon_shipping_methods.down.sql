@@ -0,0 +1 @@
+ALTER TABLE `coupons` DROP COLUMN `shipping_methods`;
@@ -0,0 +1,53 @@
+UPDATE `coupons` SET `tiers` = (
+    SELECT json_group_array(json_object(
+        'min_spend', COALESCE(json_extract(t.value, '$.min_spend'), 0) / 100.0,
+        'discount_type', json_extract(t.value, '$.discount_type'),
+        'discount_value', CASE WHEN json_extract(t.value, '$.discount_type') = 'flat'
+            THEN COALESCE(json_extract(t.value, '$.discount_amount'), 0) / 100.0
+            ELSE COALESCE(json_extract(t.value, '$.discount_value'), 0) END,
+        'max_discount', COALESCE(json_extract(t.value, '$.max_discount'), 0) / 100.0))
+    FROM json_each(`coupons`.`tiers`) AS t)
+    WHERE `tiers` IS NOT NULL AND `tiers` NOT IN ('', 'null', '[]');
+ALTER TABLE `redemption_ledger` ADD COLUMN `amount_major` real;
+UPDATE `redemption_ledger` SET `amount_major` = `amount` / 100.0;
+ALTER TABLE `redemption_ledger` DROP COLUMN `amount`;
+ALTER TABLE `redemption_ledger` RENAME COLUMN `amount_major` TO `amount`;
+ALTER TABLE `reservations` ADD COLUMN `discount_major` real;
+UPDATE `reservations` SET `discount_major` = `discount` / 100.0;
+ALTER TABLE `reservations` DROP COLUMN `discount`;
+ALTER TABLE `reservations` RENAME COLUMN `discount_major` TO `discount`;
+ALTER TABLE `reservations` ADD COLUMN `order_total_major` real;
+UPDATE `reservations` SET `order_total_major` = `order_total` / 100.0;
+ALTER TABLE `reservations` DROP COLUMN `order_total`;
+ALTER TABLE `reservations` RENAME COLUMN `order_total_major` TO `order_total`;
+ALTER TABLE `redemptions` ADD COLUMN `clawed_back_major` real;
+UPDATE `redemptions` SET `clawed_back_major` = `clawed_back` / 100.0;
+ALTER TABLE `redemptions` DROP COLUMN `clawed_back`;
+ALTER TABLE `redemptions` RENAME COLUMN `clawed_back_major` TO `clawed_back`;
+ALTER TABLE `redemptions` ADD COLUMN `refunded_amount_major` real;
+UPDATE `redemptions` SET `refunded_amount_major` = `refunded_amount` / 100.0;
+ALTER TABLE `redemptions` DROP COLUMN `refunded_amount`;
+ALTER TABLE `redemptions` RENAME COLUMN `refunded_amount_major` TO `refunded_amount`;
+ALTER TABLE `redemptions` ADD COLUMN `discount_major` real;
+UPDATE `redemptions` SET `discount_major` = `discount` / 100.0;
+ALTER TABLE `redemptions` DROP COLUMN `discount`;
+ALTER TABLE `redemptions` RENAME COLUMN `discount_major` TO `discount`;
+ALTER TABLE `redemptions` ADD COLUMN `order_total_major` real;
+UPDATE `redemptions` SET `order_total_major` = `order_total` / 100.0;
+ALTER TABLE `redemptions` DROP COLUMN `order_total`;
+ALTER TABLE `redemptions` RENAME COLUMN `order_total_major` TO `order_total`;
+ALTER TABLE `coupons` ADD COLUMN `max_discount_major` real;
+UPDATE `coupons` SET `max_discount_major` = `max_discount` / 100.0;
+ALTER TABLE `coupons` DROP COLUMN `max_discount`;
+ALTER TABLE `coupons` RENAME COLUMN `max_discount_major` TO `max_discount`;
+ALTER TABLE `coupons` ADD COLUMN `min_order_value_major` real;
+UPDATE `coupons` SET `min_order_value_major` = `min_order_value` / 100.0;
+ALTER TABLE `coupons` DROP COLUMN `min_order_value`;
+ALTER TABLE `coupons` RENAME COLUMN `min_order_value_major` TO `min_order_value`;
+ALTER TABLE `redemption_ledger` DROP COLUMN `currency`;
+ALTER TABLE `reservations` DROP COLUMN `currency`;
+ALTER TABLE `redemptions` DROP COLUMN `currency`;
+ALTER TABLE `coupons` DROP COLUMN `prices`;
+ALTER TABLE `coupons` DROP COLUMN `currency`;
+UPDATE `coupons` SET `discount_value` = `discount_amount` / 100.0 WHERE `discount_type` IN ('flat', 'shipping_flat');
+ALTER TABLE `coupons` DROP COLUMN `discount_amount`;
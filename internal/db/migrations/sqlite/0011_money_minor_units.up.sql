@@ -0,0 +1,62 @@
+-- Amounts become integer minor units with a currency. Existing amounts were
+-- in major units of the default currency, USD, and are multiplied by 100.
+
+ALTER TABLE `coupons` ADD COLUMN `discount_amount` integer NOT NULL DEFAULT 0;
+UPDATE `coupons` SET `discount_amount` = CAST(ROUND(COALESCE(`discount_value`, 0) * 100) AS INTEGER), `discount_value` = 0
+    WHERE `discount_type` IN ('flat', 'shipping_flat');
+ALTER TABLE `coupons` ADD COLUMN `currency` text NOT NULL DEFAULT 'USD';
+ALTER TABLE `coupons` ADD COLUMN `prices` text;
+ALTER TABLE `redemptions` ADD COLUMN `currency` text NOT NULL DEFAULT 'USD';
+ALTER TABLE `reservations` ADD COLUMN `currency` text NOT NULL DEFAULT 'USD';
+ALTER TABLE `redemption_ledger` ADD COLUMN `currency` text NOT NULL DEFAULT 'USD';
+
+-- SQLite cannot change a column's type, so each amount is copied into a new column
+ALTER TABLE `coupons` ADD COLUMN `min_order_value_minor` integer NOT NULL DEFAULT 0;
+UPDATE `coupons` SET `min_order_value_minor` = CAST(ROUND(COALESCE(`min_order_value`, 0) * 100) AS INTEGER);
+ALTER TABLE `coupons` DROP COLUMN `min_order_value`;
+ALTER TABLE `coupons` RENAME COLUMN `min_order_value_minor` TO `min_order_value`;
+ALTER TABLE `coupons` ADD COLUMN `max_discount_minor` integer NOT NULL DEFAULT 0;
+UPDATE `coupons` SET `max_discount_minor` = CAST(ROUND(COALESCE(`max_discount`, 0) * 100) AS INTEGER);
+ALTER TABLE `coupons` DROP COLUMN `max_discount`;
+ALTER TABLE `coupons` RENAME COLUMN `max_discount_minor` TO `max_discount`;
+ALTER TABLE `redemptions` ADD COLUMN `order_total_minor` integer NOT NULL DEFAULT 0;
+UPDATE `redemptions` SET `order_total_minor` = CAST(ROUND(COALESCE(`order_total`, 0) * 100) AS INTEGER);
+ALTER TABLE `redemptions` DROP COLUMN `order_total`;
+ALTER TABLE `redemptions` RENAME COLUMN `order_total_minor` TO `order_total`;
+ALTER TABLE `redemptions` ADD COLUMN `discount_minor` integer NOT NULL DEFAULT 0;
+UPDATE `redemptions` SET `discount_minor` = CAST(ROUND(COALESCE(`discount`, 0) * 100) AS INTEGER);
+ALTER TABLE `redemptions` DROP COLUMN `discount`;
+ALTER TABLE `redemptions` RENAME COLUMN `discount_minor` TO `discount`;
+ALTER TABLE `redemptions` ADD COLUMN `refunded_amount_minor` integer NOT NULL DEFAULT 0;
+UPDATE `redemptions` SET `refunded_amount_minor` = CAST(ROUND(COALESCE(`refunded_amount`, 0) * 100) AS INTEGER);
+ALTER TABLE `redemptions` DROP COLUMN `refunded_amount`;
+ALTER TABLE `redemptions` RENAME COLUMN `refunded_amount_minor` TO `refunded_amount`;
+ALTER TABLE `redemptions` ADD COLUMN `clawed_back_minor` integer NOT NULL DEFAULT 0;
+UPDATE `redemptions` SET `clawed_back_minor` = CAST(ROUND(COALESCE(`clawed_back`, 0) * 100) AS INTEGER);
+ALTER TABLE `redemptions` DROP COLUMN `clawed_back`;
+ALTER TABLE `redemptions` RENAME COLUMN `clawed_back_minor` TO `clawed_back`;
+ALTER TABLE `reservations` ADD COLUMN `order_total_minor` integer NOT NULL DEFAULT 0;
+UPDATE `reservations` SET `order_total_minor` = CAST(ROUND(COALESCE(`order_total`, 0) * 100) AS INTEGER);
+ALTER TABLE `reservations` DROP COLUMN `order_total`;
+ALTER TABLE `reservations` RENAME COLUMN `order_total_minor` TO `order_total`;
+ALTER TABLE `reservations` ADD COLUMN `discount_minor` integer NOT NULL DEFAULT 0;
+UPDATE `reservations` SET `discount_minor` = CAST(ROUND(COALESCE(`discount`, 0) * 100) AS INTEGER);
+ALTER TABLE `reservations` DROP COLUMN `discount`;
+ALTER TABLE `reservations` RENAME COLUMN `discount_minor` TO `discount`;
+ALTER TABLE `redemption_ledger` ADD COLUMN `amount_minor` integer NOT NULL DEFAULT 0;
+UPDATE `redemption_ledger` SET `amount_minor` = CAST(ROUND(COALESCE(`amount`, 0) * 100) AS INTEGER);
+ALTER TABLE `redemption_ledger` DROP COLUMN `amount`;
+ALTER TABLE `redemption_ledger` RENAME COLUMN `amount_minor` TO `amount`;
+
+-- Tier amounts are stored in the tiers JSON, and flat tiers move their value to discount_amount
+UPDATE `coupons` SET `tiers` = (
+    SELECT json_group_array(json_object(
+        'min_spend', CAST(ROUND(COALESCE(json_extract(t.value, '$.min_spend'), 0) * 100) AS INTEGER),
+        'discount_type', json_extract(t.value, '$.discount_type'),
+        'discount_value', CASE WHEN json_extract(t.value, '$.discount_type') = 'flat' THEN 0
+            ELSE COALESCE(json_extract(t.value, '$.discount_value'), 0) END,
+        'discount_amount', CASE WHEN json_extract(t.value, '$.discount_type') = 'flat'
+            THEN CAST(ROUND(COALESCE(json_extract(t.value, '$.discount_value'), 0) * 100) AS INTEGER) ELSE 0 END,
+        'max_discount', CAST(ROUND(COALESCE(json_extract(t.value, '$.max_discount'), 0) * 100) AS INTEGER)))
+    FROM json_each(`coupons`.`tiers`) AS t)
+    WHERE `tiers` IS NOT NULL AND `tiers` NOT IN ('', 'null', '[]');
@@ -0,0 +1,11 @@
+-- Exchange rates convert coupon amounts into the currency of a cart. Each pair
+-- keeps its history, and a rate applies from its effective time onwards.
+CREATE TABLE IF NOT EXISTS `exchange_rates` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `base_currency` text,
+    `quote_currency` text,
+    `rate` real,
+    `effective_at` datetime,
+    `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_exchange_rates_pair` ON `exchange_rates`(`base_currency`,`quote_currency`,`effective_at`);
@@ -0,0 +1,4 @@
+-- Coupon dates are stored in UTC so they compare correctly as text. Dates saved
+-- earlier keep the offset they were sent with and are converted here.
+UPDATE `coupons` SET `start_date` = strftime('%Y-%m-%d %H:%M:%f+00:00', `start_date`) WHERE `start_date` IS NOT NULL;
+UPDATE `coupons` SET `end_date` = strftime('%Y-%m-%d %H:%M:%f+00:00', `end_date`) WHERE `end_date` IS NOT NULL;
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+	"gorm.io/gorm"
+)
+
+// couponCursor is the position after the last coupon of a page. It is handed to
+// clients base64 encoded and is opaque to them.
+type couponCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"i"`
+}
+
+func (db *DB) ListCouponsPage(ctx context.Context, q *model.CouponQuery) (*model.CouponPage, error) {
+	// The sort field is interpolated into the query, so only known columns are accepted
+	switch q.Sort {
+	case model.CouponSortCreatedAt, model.CouponSortEndDate, model.CouponSortCode:
+	default:
+		return nil, fmt.Errorf("unsupported sort field %q", q.Sort)
+	}
+
+	query, err := applyCouponFilter(db.WithContext(ctx), &q.CouponFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	direction, cmp := "ASC", ">"
+	if q.Desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeCouponCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort || cursor.Desc != q.Desc {
+			return nil, model.ErrInvalidCursor
+		}
+
+		value, err := cursorValue(q.Sort, cursor.Value)
+		if err != nil {
+			return nil, model.ErrInvalidCursor
+		}
+
+		// Keyset pagination: the id breaks ties between equal sort values
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", q.Sort, cmp, q.Sort, cmp),
+			value, value, cursor.ID,
+		)
+	}
+
+	var coupons []*model.Coupon
+	if err := query.
+		Order(fmt.Sprintf("%s %s, id %s", q.Sort, direction, direction)).
+		Limit(q.Limit + 1).
+		Find(&coupons).Error; err != nil {
+		return nil, err
+	}
+
+	page := &model.CouponPage{Coupons: coupons}
+	if len(coupons) > q.Limit {
+		page.Coupons = coupons[:q.Limit]
+		last := page.Coupons[q.Limit-1]
+		page.NextCursor, err = encodeCouponCursor(&couponCursor{
+			Sort:  q.Sort,
+			Desc:  q.Desc,
+			Value: sortValue(q.Sort, last),
+			ID:    last.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// applyCouponFilter adds the filter's conditions to the query
+func applyCouponFilter(query *gorm.DB, filter *model.CouponFilter) (*gorm.DB, error) {
+	if filter.Active != nil {
+		query = query.Where("is_active = ?", *filter.Active)
+	}
+	// Dates are stored in UTC, which SQLite compares as text
+	if filter.ValidFrom != nil {
+		query = query.Where("end_date >= ?", filter.ValidFrom.UTC())
+	}
+	if filter.ValidTo != nil {
+		query = query.Where("start_date <= ?", filter.ValidTo.UTC())
+	}
+	if filter.DiscountType != "" {
+		query = query.Where("discount_type = ?", filter.DiscountType)
+	}
+	if filter.Currency != "" {
+		// Prices are stored as a JSON array of objects naming their currency
+		encoded, err := json.Marshal(filter.Currency)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(currency = ? OR prices LIKE ? ESCAPE '!')", filter.Currency,
+			"%\"currency\":"+escapeLike(string(encoded))+"%")
+	}
+	if filter.OrderTotal != nil {
+		// Minimums in other currencies cannot be compared with the total here.
+		// Coupons naming no currency are in the default one.
+		currencies := []string{filter.OrderCurrency}
+		if filter.OrderCurrency == "" || filter.OrderCurrency == model.DefaultCurrency {
+			currencies = []string{model.DefaultCurrency, ""}
+		}
+		query = query.Where("(currency NOT IN ? OR min_order_value <= ?)", currencies, *filter.OrderTotal)
+	}
+	if len(filter.Items) > 0 || len(filter.Categories) > 0 || len(filter.Brands) > 0 {
+		conditions := []string{"(" + strings.Join([]string{
+			emptyJSONList("applicable_items"),
+			emptyJSONList("include_categories"),
+			emptyJSONList("include_brands"),
+		}, " AND ") + ")"}
+		var args []interface{}
+
+		lists := []struct {
+			column string
+			values []string
+		}{
+			{"applicable_items", filter.Items},
+			{"include_categories", filter.Categories},
+			{"include_brands", filter.Brands},
+		}
+		for _, list := range lists {
+			// The lists are stored as JSON arrays of strings
+			for _, value := range list.values {
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return nil, err
+				}
+				conditions = append(conditions, list.column+" LIKE ? ESCAPE '!'")
+				args = append(args, "%"+escapeLike(string(encoded))+"%")
+			}
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return query, nil
+}
+
+// emptyJSONList returns a condition matching rows whose JSON list column is empty
+func emptyJSONList(column string) string {
+	return fmt.Sprintf("(%[1]s IS NULL OR %[1]s IN ('', 'null', '[]'))", column)
+}
+
+// escapeLike escapes the LIKE wildcards in s with '!', which unlike a backslash
+// needs no quoting in any supported dialect
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// sortValue returns the coupon's value for the sort field as stored in a cursor
+func sortValue(sort string, coupon *model.Coupon) string {
+	switch sort {
+	case model.CouponSortCode:
+		return coupon.Code
+	case model.CouponSortEndDate:
+		return coupon.EndDate.UTC().Format(time.RFC3339Nano)
+	default:
+		return coupon.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// cursorValue converts a cursor's sort value back into a query argument
+func cursorValue(sort string, value string) (interface{}, error) {
+	switch sort {
+	case model.CouponSortCode:
+		return value, nil
+	case model.CouponSortEndDate, model.CouponSortCreatedAt:
+		// Compared in UTC like the stored dates
+		at, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, err
+		}
+		return at.UTC(), nil
+	default:
+		return nil, model.ErrInvalidCursor
+	}
+}
+
+func encodeCouponCursor(cursor *couponCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCouponCursor(encoded string) (*couponCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor couponCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
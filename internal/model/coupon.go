@@ -2,48 +2,360 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Supported discount types. Percentages come from DiscountValue and flat
+// amounts from DiscountAmount.
+const (
+	DiscountTypePercentage = "percentage"
+	DiscountTypeFlat       = "flat"
+
+	// DiscountTypeBuyXGetY gives DiscountValue percent off GetQuantity reward
+	// units for every BuyQuantity qualifying units bought
+	DiscountTypeBuyXGetY = "buy_x_get_y"
+
+	// DiscountTypeCheapestFree gives DiscountValue percent off the GetQuantity
+	// cheapest units of every BuyQuantity qualifying units
+	DiscountTypeCheapestFree = "cheapest_free"
+
+	// DiscountTypeTiered gives the discount of the highest of the coupon's Tiers
+	// whose MinSpend the eligible lines reach
+	DiscountTypeTiered = "tiered"
+
+	// Shipping discounts come off the cart's shipping rather than its lines:
+	// all of it, DiscountValue percent of it or a flat DiscountAmount
+	DiscountTypeFreeShipping       = "free_shipping"
+	DiscountTypeShippingPercentage = "shipping_percentage"
+	DiscountTypeShippingFlat       = "shipping_flat"
 )
 
-// Coupon represents a discount coupon
+// Coupon represents a discount coupon. A cart item is eligible for the coupon
+// when it matches one of the include rules (ApplicableItems by item ID or SKU,
+// IncludeCategories or IncludeBrands), or the coupon has no include rules, and
+// it matches none of the exclude rules. Shipping discounts are limited to
+// ShippingMethods when it is set. The coupon's amounts are in its Currency, and
+// Prices redefine them for the other currencies it is offered in. Rule is an
+// optional eligibility expression the cart must also satisfy. A coupon only
+// stacks with coupons in its StackGroup; one without a group is used alone.
 type Coupon struct {
-	ID              uint      `json:"id" gorm:"primaryKey"`
-	Code            string    `json:"code" gorm:"uniqueIndex"`
-	DiscountType    string    `json:"discount_type"`
-	DiscountValue   float64   `json:"discount_value"`
-	MinOrderValue   float64   `json:"min_order_value"`
-	MaxDiscount     float64   `json:"max_discount"`
-	StartDate       time.Time `json:"start_date"`
-	EndDate         time.Time `json:"end_date"`
-	UsageLimit      int       `json:"usage_limit"`
-	UsageCount      int       `json:"usage_count"`
-	IsActive        bool      `json:"is_active"`
-	ApplicableItems []string  `json:"applicable_items" gorm:"type:text;serializer:json"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-}
-
-// Cart represents a shopping cart
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	Code              string         `json:"code" gorm:"uniqueIndex"`
+	DiscountType      string         `json:"discount_type"`
+	DiscountValue     float64        `json:"discount_value"`
+	DiscountAmount    Money          `json:"discount_amount"`
+	MinOrderValue     Money          `json:"min_order_value"`
+	MaxDiscount       Money          `json:"max_discount"`
+	Currency          string         `json:"currency"`
+	Prices            []CouponPrice  `json:"prices" gorm:"type:text;serializer:json"`
+	StartDate         time.Time      `json:"start_date"`
+	EndDate           time.Time      `json:"end_date"`
+	UsageLimit        int            `json:"usage_limit"`
+	UsageCount        int            `json:"usage_count"`
+	ReservedCount     int            `json:"reserved_count"`
+	PerCustomerLimit  int            `json:"per_customer_limit"`
+	FirstOrderOnly    bool           `json:"first_order_only"`
+	Exclusive         bool           `json:"exclusive"`
+	StackGroup        string         `json:"stack_group"`
+	Priority          int            `json:"priority"`
+	IsActive          bool           `json:"is_active"`
+	ApplicableItems   []string       `json:"applicable_items" gorm:"type:text;serializer:json"`
+	IncludeCategories []string       `json:"include_categories" gorm:"type:text;serializer:json"`
+	ExcludeCategories []string       `json:"exclude_categories" gorm:"type:text;serializer:json"`
+	IncludeBrands     []string       `json:"include_brands" gorm:"type:text;serializer:json"`
+	ExcludeBrands     []string       `json:"exclude_brands" gorm:"type:text;serializer:json"`
+	ExcludeOnSale     bool           `json:"exclude_on_sale"`
+	BuyQuantity       int            `json:"buy_quantity"`
+	GetQuantity       int            `json:"get_quantity"`
+	RewardItems       []string       `json:"reward_items" gorm:"type:text;serializer:json"`
+	MaxApplications   int            `json:"max_applications"`
+	Tiers             []DiscountTier `json:"tiers" gorm:"type:text;serializer:json"`
+	ShippingMethods   []string       `json:"shipping_methods" gorm:"type:text;serializer:json"`
+	Rule              string         `json:"rule"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// DiscountTier represents one spend threshold of a tiered coupon and the
+// percentage or flat discount it gives
+type DiscountTier struct {
+	MinSpend       Money   `json:"min_spend"`
+	DiscountType   string  `json:"discount_type"`
+	DiscountValue  float64 `json:"discount_value"`
+	DiscountAmount Money   `json:"discount_amount"`
+	MaxDiscount    Money   `json:"max_discount"`
+}
+
+// CouponPrice represents a coupon's amounts in another currency. The prices of a
+// tiered coupon carry its tiers in that currency.
+type CouponPrice struct {
+	Currency       string         `json:"currency"`
+	DiscountAmount Money          `json:"discount_amount"`
+	MinOrderValue  Money          `json:"min_order_value"`
+	MaxDiscount    Money          `json:"max_discount"`
+	Tiers          []DiscountTier `json:"tiers,omitempty"`
+}
+
+// Cart represents a shopping cart. Total is the amount the customer pays: the
+// subtotal of the lines plus shipping, tax and fees. Shipping is the cost of
+// the chosen ShippingMethod. All amounts are in the cart's Currency.
 type Cart struct {
-	Items []CartItem `json:"items"`
-	Total float64    `json:"total"`
+	CustomerID     string     `json:"customer_id"`
+	CustomerTier   string     `json:"customer_tier"`
+	Channel        string     `json:"channel"`
+	Currency       string     `json:"currency"`
+	Items          []CartItem `json:"items"`
+	ShippingMethod string     `json:"shipping_method"`
+	Shipping       Money      `json:"shipping"`
+	Tax            Money      `json:"tax"`
+	Fees           Money      `json:"fees"`
+	Total          Money      `json:"total"`
 }
 
-// CartItem represents an item in the cart
+// Subtotal returns the amount of all the cart's lines
+func (c *Cart) Subtotal() Money {
+	var subtotal Money
+	for _, item := range c.Items {
+		subtotal += item.Amount()
+	}
+	return subtotal
+}
+
+// CartItem represents a line in the cart. Price is the unit price.
 type CartItem struct {
-	ID    string  `json:"id"`
-	Price float64 `json:"price"`
+	ID          string   `json:"id"`
+	SKU         string   `json:"sku"`
+	Price       Money    `json:"price"`
+	Quantity    int      `json:"quantity"`
+	CategoryIDs []string `json:"category_ids"`
+	Brand       string   `json:"brand"`
+	OnSale      bool     `json:"on_sale"`
+}
+
+// Units returns the number of units on the line. A missing quantity counts as one.
+func (i CartItem) Units() int {
+	if i.Quantity < 1 {
+		return 1
+	}
+	return i.Quantity
+}
+
+// Amount returns the price of the whole line
+func (i CartItem) Amount() Money {
+	return i.Price * Money(i.Units())
 }
 
 // CreateCouponRequest represents the request for creating a coupon
 type CreateCouponRequest struct {
-	Code            string    `json:"code"`
-	DiscountType    string    `json:"discount_type"`
-	DiscountValue   float64   `json:"discount_value"`
-	MinOrderValue   float64   `json:"min_order_value"`
-	MaxDiscount     float64   `json:"max_discount"`
-	StartDate       time.Time `json:"start_date"`
-	EndDate         time.Time `json:"end_date"`
-	UsageLimit      int       `json:"usage_limit"`
-	IsActive        bool      `json:"is_active"`
-	ApplicableItems []string  `json:"applicable_items"`
+	Code              string         `json:"code"`
+	DiscountType      string         `json:"discount_type"`
+	DiscountValue     float64        `json:"discount_value"`
+	DiscountAmount    Money          `json:"discount_amount"`
+	MinOrderValue     Money          `json:"min_order_value"`
+	MaxDiscount       Money          `json:"max_discount"`
+	Currency          string         `json:"currency"`
+	Prices            []CouponPrice  `json:"prices"`
+	StartDate         time.Time      `json:"start_date"`
+	EndDate           time.Time      `json:"end_date"`
+	UsageLimit        int            `json:"usage_limit"`
+	PerCustomerLimit  int            `json:"per_customer_limit"`
+	FirstOrderOnly    bool           `json:"first_order_only"`
+	Exclusive         bool           `json:"exclusive"`
+	StackGroup        string         `json:"stack_group"`
+	Priority          int            `json:"priority"`
+	IsActive          bool           `json:"is_active"`
+	ApplicableItems   []string       `json:"applicable_items"`
+	IncludeCategories []string       `json:"include_categories"`
+	ExcludeCategories []string       `json:"exclude_categories"`
+	IncludeBrands     []string       `json:"include_brands"`
+	ExcludeBrands     []string       `json:"exclude_brands"`
+	ExcludeOnSale     bool           `json:"exclude_on_sale"`
+	BuyQuantity       int            `json:"buy_quantity"`
+	GetQuantity       int            `json:"get_quantity"`
+	RewardItems       []string       `json:"reward_items"`
+	MaxApplications   int            `json:"max_applications"`
+	Tiers             []DiscountTier `json:"tiers"`
+	ShippingMethods   []string       `json:"shipping_methods"`
+	Rule              string         `json:"rule"`
+}
+
+// CouponFilter represents the criteria for listing coupons. A date window matches
+// coupons whose validity period overlaps it. Items, categories and brands match
+// coupons whose include rules name any of them, or that have no include rules.
+// OrderTotal, in OrderCurrency, only limits the minimum order value of coupons
+// in that currency.
+type CouponFilter struct {
+	Active        *bool      `form:"active"`
+	ValidFrom     *time.Time `form:"valid_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	ValidTo       *time.Time `form:"valid_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	DiscountType  string     `form:"discount_type"`
+	Currency      string     `form:"currency"`
+	Items         []string   `form:"item"`
+	Categories    []string   `form:"category"`
+	Brands        []string   `form:"brand"`
+	OrderTotal    *Money     `form:"order_total"`
+	OrderCurrency string     `form:"order_currency"`
+}
+
+// Coupon sort fields
+const (
+	CouponSortCreatedAt = "created_at"
+	CouponSortEndDate   = "end_date"
+	CouponSortCode      = "code"
+)
+
+// CouponQuery represents a request for one page of filtered, sorted coupons
+type CouponQuery struct {
+	CouponFilter
+	Sort   string `form:"sort"`
+	Desc   bool   `form:"desc"`
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+// CouponPage represents one page of coupons and the cursor of the next page
+type CouponPage struct {
+	Coupons    []*Coupon `json:"coupons"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// CouponPatch represents a partial coupon update, nil fields are left unchanged
+type CouponPatch struct {
+	DiscountType      *string         `json:"discount_type"`
+	DiscountValue     *float64        `json:"discount_value"`
+	DiscountAmount    *Money          `json:"discount_amount"`
+	MinOrderValue     *Money          `json:"min_order_value"`
+	MaxDiscount       *Money          `json:"max_discount"`
+	Currency          *string         `json:"currency"`
+	Prices            *[]CouponPrice  `json:"prices"`
+	StartDate         *time.Time      `json:"start_date"`
+	EndDate           *time.Time      `json:"end_date"`
+	UsageLimit        *int            `json:"usage_limit"`
+	PerCustomerLimit  *int            `json:"per_customer_limit"`
+	FirstOrderOnly    *bool           `json:"first_order_only"`
+	Exclusive         *bool           `json:"exclusive"`
+	StackGroup        *string         `json:"stack_group"`
+	Priority          *int            `json:"priority"`
+	IsActive          *bool           `json:"is_active"`
+	ApplicableItems   *[]string       `json:"applicable_items"`
+	IncludeCategories *[]string       `json:"include_categories"`
+	ExcludeCategories *[]string       `json:"exclude_categories"`
+	IncludeBrands     *[]string       `json:"include_brands"`
+	ExcludeBrands     *[]string       `json:"exclude_brands"`
+	ExcludeOnSale     *bool           `json:"exclude_on_sale"`
+	BuyQuantity       *int            `json:"buy_quantity"`
+	GetQuantity       *int            `json:"get_quantity"`
+	RewardItems       *[]string       `json:"reward_items"`
+	MaxApplications   *int            `json:"max_applications"`
+	Tiers             *[]DiscountTier `json:"tiers"`
+	ShippingMethods   *[]string       `json:"shipping_methods"`
+	Rule              *string         `json:"rule"`
+}
+
+// DiscountResult represents the discount a coupon gives a cart. Discount is the
+// sum of the MerchandiseDiscount off the lines and the ShippingDiscount. Rate is
+// the exchange rate the coupon's amounts were converted into the cart's currency
+// at, when it is not priced in that currency.
+type DiscountResult struct {
+	Currency            string         `json:"currency"`
+	Subtotal            Money          `json:"subtotal"`
+	Discount            Money          `json:"discount"`
+	MerchandiseDiscount Money          `json:"merchandise_discount"`
+	ShippingDiscount    Money          `json:"shipping_discount"`
+	Total               Money          `json:"total"`
+	Items               []ItemDiscount `json:"items"`
+	Rewards             []RewardLine   `json:"rewards,omitempty"`
+	Tier                *TierProgress  `json:"tier,omitempty"`
+	Rate                *ExchangeRate  `json:"rate,omitempty"`
+}
+
+// TierProgress reports the tier a cart reached on a tiered coupon and how much
+// more the eligible lines need to reach the next one
+type TierProgress struct {
+	Spend     Money         `json:"spend"`
+	Level     int           `json:"level"`
+	Reached   *DiscountTier `json:"reached,omitempty"`
+	Next      *DiscountTier `json:"next,omitempty"`
+	Remaining Money         `json:"remaining"`
+}
+
+// RewardLine represents the units of a cart line a promotion discounts
+type RewardLine struct {
+	ID       string `json:"id"`
+	Price    Money  `json:"price"`
+	Quantity int    `json:"quantity"`
+	Discount Money  `json:"discount"`
+}
+
+// ItemDiscount represents the share of a discount allocated to a cart line.
+// Price is the unit price and Total what is left of the line after the discount.
+type ItemDiscount struct {
+	ID       string `json:"id"`
+	Price    Money  `json:"price"`
+	Quantity int    `json:"quantity"`
+	Discount Money  `json:"discount"`
+	Total    Money  `json:"total"`
+}
+
+// ApplicableCoupon represents a coupon applicable to a cart and its discount
+type ApplicableCoupon struct {
+	*Coupon
+	Discount *DiscountResult `json:"discount"`
+}
+
+// CouponCombination represents coupons applied to a cart together. Each coupon's
+// discount is computed on the cart left after the coupons before it, and the
+// combined discount sums them up.
+type CouponCombination struct {
+	Coupons  []*ApplicableCoupon `json:"coupons"`
+	Discount *DiscountResult     `json:"discount"`
+}
+
+// ValidationResult represents the outcome of validating a coupon against a cart.
+// An invalid result lists the reason for every rule the cart failed.
+type ValidationResult struct {
+	Valid    bool            `json:"valid"`
+	Discount *DiscountResult `json:"discount,omitempty"`
+	Reasons  []Reason        `json:"reasons,omitempty"`
+}
+
+// Reason codes explaining why a coupon does not apply to a cart
+const (
+	ReasonCouponNotFound       = "coupon_not_found"
+	ReasonCouponInactive       = "coupon_inactive"
+	ReasonCouponNotStarted     = "coupon_not_started"
+	ReasonCouponExpired        = "coupon_expired"
+	ReasonMinOrderValueNotMet  = "min_order_value_not_met"
+	ReasonUsageLimitReached    = "usage_limit_reached"
+	ReasonCustomerRequired     = "customer_required"
+	ReasonCustomerLimitReached = "customer_limit_reached"
+	ReasonNotFirstOrder        = "not_first_order"
+	ReasonNoApplicableItems    = "no_applicable_items"
+	ReasonPromotionNotMet      = "promotion_not_met"
+	ReasonTierNotReached       = "tier_not_reached"
+	ReasonNoShippingCharge     = "no_shipping_charge"
+	ReasonCurrencyNotOffered   = "currency_not_offered"
+	ReasonShippingNotEligible  = "shipping_method_not_eligible"
+	ReasonRuleNotMet           = "rule_not_met"
+)
+
+// Reason represents a failed coupon rule as a machine-readable code and a message
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RejectedCoupon represents a coupon that does not apply to a cart and why
+type RejectedCoupon struct {
+	*Coupon
+	Reasons []Reason `json:"reasons"`
+}
+
+// ApplicabilityReport represents every coupon checked against a cart, split into
+// the applicable ones and the rejected ones
+type ApplicabilityReport struct {
+	Applicable []*ApplicableCoupon `json:"applicable"`
+	Rejected   []*RejectedCoupon   `json:"rejected"`
 }
@@ -0,0 +1,53 @@
+package model
+
+// ErrorKind classifies an error by what went wrong, so callers can react to a
+// whole class of errors, such as answering every validation error with 400
+type ErrorKind int
+
+// Error kinds
+const (
+	// KindInternal is an unexpected failure, such as a database error
+	KindInternal ErrorKind = iota
+
+	// KindValidation is a malformed or out of range input
+	KindValidation
+
+	// KindNotFound is a reference to a coupon, reservation or redemption that does not exist
+	KindNotFound
+
+	// KindConflict is a request that clashes with the current state, such as a duplicate code
+	KindConflict
+
+	// KindRuleViolation is a well-formed request that a coupon rule forbids
+	KindRuleViolation
+)
+
+// Error represents a cataloged error with a kind and a stable machine-readable
+// code. Errors are compared with errors.Is against the package sentinels.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	message string
+}
+
+// NewError creates a new Error
+func NewError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, message: message}
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return e.message
+}
+
+// WithDetail returns a copy of the error whose message ends with the detail.
+// The copy still matches the error with errors.Is.
+func (e *Error) WithDetail(detail string) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, message: e.message + ": " + detail}
+}
+
+// Is reports whether the target is the same cataloged error
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == e.Code
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// Ledger entry statuses
+const (
+	LedgerStatusRedeemed          = "redeemed"
+	LedgerStatusReversed          = "reversed"
+	LedgerStatusPartiallyReversed = "partially_reversed"
+)
+
+// LedgerEntry represents an append-only record of a coupon redemption event
+type LedgerEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CouponID   uint      `json:"coupon_id" gorm:"index"`
+	CouponCode string    `json:"coupon_code"`
+	OrderID    string    `json:"order_id" gorm:"index"`
+	CustomerID string    `json:"customer_id,omitempty" gorm:"index"`
+	Currency   string    `json:"currency"`
+	Amount     Money     `json:"amount"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName returns the ledger table name
+func (LedgerEntry) TableName() string {
+	return "redemption_ledger"
+}
+
+// LedgerFilter represents the criteria for listing ledger entries
+type LedgerFilter struct {
+	CouponCode string `form:"coupon_code"`
+	OrderID    string `form:"order_id"`
+	CustomerID string `form:"customer_id"`
+}
+
+// UsageDrift represents a coupon whose usage count disagrees with the ledger
+type UsageDrift struct {
+	CouponID    uint   `json:"coupon_id"`
+	Code        string `json:"code"`
+	UsageCount  int    `json:"usage_count"`
+	LedgerCount int    `json:"ledger_count"`
+	Fixed       bool   `json:"fixed"`
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// Money is an amount in the minor units of a currency, such as cents
+type Money int64
+
+// DefaultCurrency is the currency of carts and coupons that do not name one
+const DefaultCurrency = "USD"
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth of the major unit
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// ValidCurrency reports whether the code looks like an ISO 4217 currency code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// CurrencyExponent returns the number of minor-unit digits of the currency
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Format renders the amount in major units of the currency, such as "12.50 USD"
+func (m Money) Format(currency string) string {
+	exponent := CurrencyExponent(currency)
+	if exponent == 0 {
+		return fmt.Sprintf("%d %s", m, currency)
+	}
+
+	sign := ""
+	amount := int64(m)
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, exponent, amount%scale, currency)
+}
+
+// RoundingMode names how discount math rounds to whole minor units
+type RoundingMode string
+
+// Supported rounding modes
+const (
+	// RoundHalfUp rounds halves up, away from zero
+	RoundHalfUp RoundingMode = "half_up"
+
+	// RoundHalfEven rounds halves to the nearest even minor unit
+	RoundHalfEven RoundingMode = "half_even"
+)
+
+// Valid reports whether the rounding mode is supported
+func (m RoundingMode) Valid() bool {
+	return m == RoundHalfUp || m == RoundHalfEven
+}
+
+// MulDiv returns a*b/d rounded to a whole minor unit. The product may exceed 64
+// bits, but a and b must not be negative and the result must fit in 64 bits.
+func (m RoundingMode) MulDiv(a Money, b, d int64) Money {
+	q, ok := m.CheckedMulDiv(a, b, d)
+	if !ok {
+		panic("model: MulDiv result overflows")
+	}
+	return q
+}
+
+// CheckedMulDiv is MulDiv reporting whether the result fits in 64 bits instead
+// of requiring it
+func (m RoundingMode) CheckedMulDiv(a Money, b, d int64) (Money, bool) {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	if hi >= uint64(d) {
+		return 0, false
+	}
+	q, r := bits.Div64(hi, lo, uint64(d))
+
+	switch twice := 2 * r; {
+	case twice > uint64(d):
+		q++
+	case twice == uint64(d) && (m != RoundHalfEven || q%2 == 1):
+		q++
+	}
+	if q > math.MaxInt64 {
+		return 0, false
+	}
+	return Money(q), true
+}
+
+// Percent returns percent of the amount, rounded to a whole minor unit.
+// Percentages are applied to two decimal places.
+func (m RoundingMode) Percent(amount Money, percent float64) Money {
+	return m.MulDiv(amount, int64(math.Round(percent*100)), 10000)
+}
+
+// ParseRoundingMode parses a rounding mode name, defaulting to RoundHalfUp
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	if name == "" {
+		return RoundHalfUp, nil
+	}
+	mode := RoundingMode(strings.ToLower(name))
+	if !mode.Valid() {
+		return "", fmt.Errorf("unknown rounding mode %q", name)
+	}
+	return mode, nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// rateScale is the precision exchange rates are applied with, in parts of one
+const rateScale = 100000000
+
+// ExchangeRate represents the rate converting amounts from the base currency into
+// the quote currency. Rate is the number of major units of the quote currency one
+// major unit of the base currency buys. A rate applies from EffectiveAt until a
+// later rate for the same pair takes effect.
+type ExchangeRate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	BaseCurrency  string    `json:"base_currency" gorm:"index:idx_exchange_rates_pair"`
+	QuoteCurrency string    `json:"quote_currency" gorm:"index:idx_exchange_rates_pair"`
+	Rate          float64   `json:"rate"`
+	EffectiveAt   time.Time `json:"effective_at" gorm:"index:idx_exchange_rates_pair"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TableName returns the exchange rate table name
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
+// Valid reports whether the rate converts between two different currencies at a
+// positive rate that can be applied at full precision
+func (r *ExchangeRate) Valid() bool {
+	if !ValidCurrency(r.BaseCurrency) || !ValidCurrency(r.QuoteCurrency) || r.BaseCurrency == r.QuoteCurrency {
+		return false
+	}
+	scaled := r.Rate * rateScale
+	return scaled >= 1 && scaled < math.MaxInt64/1000
+}
+
+// Convert converts an amount in minor units of the base currency into minor
+// units of the quote currency. The rate is applied to eight decimal places and
+// the result is rounded in the given mode. The amount must not be negative. A
+// result too large for Money saturates at the largest amount.
+func (r *ExchangeRate) Convert(amount Money, rounding RoundingMode) Money {
+	num := int64(math.Round(r.Rate * rateScale))
+	den := int64(rateScale)
+
+	// Rescale between the currencies' minor units
+	shift := CurrencyExponent(r.QuoteCurrency) - CurrencyExponent(r.BaseCurrency)
+	for ; shift > 0; shift-- {
+		num *= 10
+	}
+	for ; shift < 0; shift++ {
+		den *= 10
+	}
+	converted, ok := rounding.CheckedMulDiv(amount, num, den)
+	if !ok {
+		return math.MaxInt64
+	}
+	return converted
+}
+
+// ExchangeRateFilter represents the criteria for listing exchange rates. At
+// selects the rates in effect at that time, which is now when it is unset.
+type ExchangeRateFilter struct {
+	At *time.Time `form:"at" time_format:"2006-01-02T15:04:05Z07:00"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// Redemption statuses
+const (
+	RedemptionStatusRedeemed = "redeemed"
+	RedemptionStatusReversed = "reversed"
+)
+
+// Redemption represents a coupon use consumed by an order
+type Redemption struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CouponID       uint      `json:"coupon_id" gorm:"index"`
+	CouponCode     string    `json:"coupon_code"`
+	OrderID        string    `json:"order_id" gorm:"uniqueIndex"`
+	CustomerID     string    `json:"customer_id,omitempty" gorm:"index"`
+	Currency       string    `json:"currency"`
+	OrderTotal     Money     `json:"order_total"`
+	Discount       Money     `json:"discount"`
+	Status         string    `json:"status"`
+	RefundedAmount Money     `json:"refunded_amount"`
+	ClawedBack     Money     `json:"clawed_back"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Reversal represents the outcome of reversing all or part of a redemption
+type Reversal struct {
+	OrderID      string      `json:"order_id"`
+	CouponCode   string      `json:"coupon_code"`
+	RefundAmount Money       `json:"refund_amount"`
+	Clawback     Money       `json:"clawback"`
+	Full         bool        `json:"full"`
+	Reactivated  bool        `json:"reactivated"`
+	Redemption   *Redemption `json:"redemption"`
+}
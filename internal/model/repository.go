@@ -2,6 +2,22 @@ package model
 
 import (
 	"context"
+	"time"
+)
+
+// Repository errors
+var (
+	ErrCouponCodeExists     = NewError(KindConflict, "coupon_code_exists", "coupon code already exists")
+	ErrUsageLimitReached    = NewError(KindRuleViolation, "usage_limit_reached", "coupon usage limit reached")
+	ErrOrderRedeemed        = NewError(KindConflict, "order_already_redeemed", "order already redeemed with another coupon")
+	ErrReservationNotFound  = NewError(KindNotFound, "reservation_not_found", "reservation not found")
+	ErrReservationNotActive = NewError(KindConflict, "reservation_not_active", "reservation is no longer active")
+	ErrCustomerRequired     = NewError(KindRuleViolation, "customer_required", "coupon requires a customer id")
+	ErrCustomerLimitReached = NewError(KindRuleViolation, "customer_limit_reached", "customer usage limit reached")
+	ErrNotFirstOrder        = NewError(KindRuleViolation, "not_first_order", "coupon is only valid on a customer's first order")
+	ErrRedemptionNotFound   = NewError(KindNotFound, "redemption_not_found", "redemption not found")
+	ErrRedemptionReversed   = NewError(KindConflict, "redemption_reversed", "redemption already reversed")
+	ErrInvalidCursor        = NewError(KindValidation, "invalid_cursor", "invalid cursor")
 )
 
 type Repository interface {
@@ -14,4 +30,73 @@ type Repository interface {
 	FindCouponByCode(ctx context.Context, code string) (*Coupon, error)
 
 	UpdateCoupon(ctx context.Context, coupon *Coupon) error
+
+	// ListCoupons returns the coupons matching the filter
+	ListCoupons(ctx context.Context, filter *CouponFilter) ([]*Coupon, error)
+
+	// ListCouponsPage returns one page of the coupons matching the query. The next
+	// cursor is empty on the last page.
+	ListCouponsPage(ctx context.Context, query *CouponQuery) (*CouponPage, error)
+
+	// DeleteCoupon soft deletes a coupon
+	DeleteCoupon(ctx context.Context, coupon *Coupon) error
+
+	// FindRedemptionByOrderID returns the redemption recorded for an order, or nil if there is none
+	FindRedemptionByOrderID(ctx context.Context, orderID string) (*Redemption, error)
+
+	// RedeemCoupon consumes one use of the coupon and records the redemption in a
+	// single transaction. If the order was already redeemed with the same coupon the
+	// existing redemption is returned and no further use is consumed.
+	RedeemCoupon(ctx context.Context, redemption *Redemption) (*Redemption, error)
+
+	// ReserveCoupon holds one use of the coupon until the reservation expires. Active
+	// holds count against the usage limit.
+	ReserveCoupon(ctx context.Context, reservation *Reservation) error
+
+	// CommitReservation turns an active reservation into a redemption for the order
+	CommitReservation(ctx context.Context, id string, orderID string) (*Redemption, error)
+
+	// ReleaseReservation gives an active reservation's use back to the coupon
+	ReleaseReservation(ctx context.Context, id string) (*Reservation, error)
+
+	// ExpireReservations marks active reservations past their expiry as expired
+	ExpireReservations(ctx context.Context, now time.Time) (int64, error)
+
+	// CountActiveReservations returns the number of active holds per coupon. With no
+	// coupon IDs it counts holds for every coupon.
+	CountActiveReservations(ctx context.Context, now time.Time, couponIDs ...uint) (map[uint]int, error)
+
+	// CountCustomerRedemptions returns the number of redemptions per coupon made by the
+	// customer. With no coupon IDs it counts redemptions of every coupon.
+	CountCustomerRedemptions(ctx context.Context, customerID string, couponIDs ...uint) (map[uint]int, error)
+
+	// ReverseRedemption reverses the order's redemption in a single transaction. A zero
+	// refund amount, or one covering the rest of the order, reverses it fully and gives
+	// the use back to the coupon; a smaller refund claws back the prorated discount.
+	// With reactivate set, a fully reversed single-use coupon is re-enabled. The
+	// clawback is rounded in the given mode.
+	ReverseRedemption(ctx context.Context, orderID string, refundAmount Money, reactivate bool, rounding RoundingMode) (*Reversal, error)
+
+	// ListLedgerEntries returns the ledger entries matching the filter, oldest first
+	ListLedgerEntries(ctx context.Context, filter *LedgerFilter) ([]*LedgerEntry, error)
+
+	// LedgerUsageCounts returns the net number of redemptions per coupon recorded in the ledger
+	LedgerUsageCounts(ctx context.Context) (map[uint]int, error)
+
+	// SyncUsageCount sets a coupon's usage count to its net ledger count and returns
+	// it. The coupon row is held while counting, so redemptions made meanwhile are
+	// neither lost nor counted twice.
+	SyncUsageCount(ctx context.Context, couponID uint) (int, error)
+
+	// SaveExchangeRates records the rates in a single transaction. A rate already
+	// recorded for its pair and effective time is not recorded twice.
+	SaveExchangeRates(ctx context.Context, rates []*ExchangeRate) error
+
+	// ListExchangeRates returns, for every currency pair, the latest rate in
+	// effect at the given time
+	ListExchangeRates(ctx context.Context, at time.Time) ([]*ExchangeRate, error)
+
+	// NextExchangeRateAt returns when the first rate scheduled after the given
+	// time takes effect, or the zero time when none is scheduled
+	NextExchangeRateAt(ctx context.Context, after time.Time) (time.Time, error)
 }
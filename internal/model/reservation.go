@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+)
+
+// Reservation statuses
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+// Reservation represents a coupon use held for a checkout until it is committed or released
+type Reservation struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	CouponID   uint      `json:"coupon_id" gorm:"index"`
+	CouponCode string    `json:"coupon_code"`
+	OrderID    string    `json:"order_id,omitempty"`
+	CustomerID string    `json:"customer_id,omitempty" gorm:"index"`
+	Currency   string    `json:"currency"`
+	OrderTotal Money     `json:"order_total"`
+	Discount   Money     `json:"discount"`
+	Status     string    `json:"status" gorm:"index"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
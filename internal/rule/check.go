@@ -0,0 +1,460 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// typeKind classifies a type
+type typeKind int
+
+const (
+	kindBool typeKind = iota
+	kindInt
+	kindString
+	kindList
+	kindObject
+)
+
+// ruleType represents the static type of an expression. Lists carry their
+// element type and objects their fields.
+type ruleType struct {
+	kind   typeKind
+	name   string
+	elem   *ruleType
+	fields map[string]*field
+}
+
+// field represents an attribute of an object and how to read it from the
+// object's value
+type field struct {
+	typ *ruleType
+	get func(s *state, object interface{}) interface{}
+}
+
+var (
+	boolType   = &ruleType{kind: kindBool, name: "bool"}
+	intType    = &ruleType{kind: kindInt, name: "int"}
+	stringType = &ruleType{kind: kindString, name: "string"}
+
+	// emptyListType is the type of [], which is a list of any element type
+	emptyListType = &ruleType{kind: kindList, name: "list"}
+)
+
+// listOf returns the type of lists of the element type
+func listOf(elem *ruleType) *ruleType {
+	return &ruleType{kind: kindList, name: "list of " + elem.name, elem: elem}
+}
+
+// String returns the type's name
+func (t *ruleType) String() string {
+	return t.name
+}
+
+// evalFunc evaluates a checked expression
+type evalFunc func(s *state) (interface{}, error)
+
+// state holds one evaluation's attributes, bound variables and step count
+type state struct {
+	env   *Env
+	vars  []interface{}
+	steps int
+}
+
+// step counts one evaluation step against the budget
+func (s *state) step() error {
+	s.steps++
+	if s.steps > MaxSteps {
+		return ErrStepLimit
+	}
+	return nil
+}
+
+// scope maps the variables bound by list macros to their slots
+type scope struct {
+	name   string
+	typ    *ruleType
+	slot   int
+	parent *scope
+}
+
+func (sc *scope) lookup(name string) *scope {
+	for ; sc != nil; sc = sc.parent {
+		if sc.name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+// checker type-checks a syntax tree and compiles it into evaluation functions
+type checker struct {
+	slots   int
+	usesNow bool
+}
+
+func (c *checker) check(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	switch n.kind {
+	case nodeInt:
+		value := n.intVal
+		return intType, func(s *state) (interface{}, error) { return value, s.step() }, nil
+	case nodeString:
+		value := n.strVal
+		return stringType, func(s *state) (interface{}, error) { return value, s.step() }, nil
+	case nodeBool:
+		value := n.boolVal
+		return boolType, func(s *state) (interface{}, error) { return value, s.step() }, nil
+	case nodeIdent:
+		return c.checkIdent(n, sc)
+	case nodeList:
+		return c.checkList(n, sc)
+	case nodeField:
+		return c.checkField(n, sc)
+	case nodeCall:
+		return c.checkCall(n, sc)
+	case nodeUnary:
+		return c.checkUnary(n, sc)
+	case nodeBinary:
+		return c.checkBinary(n, sc)
+	}
+	return nil, nil, &Error{Pos: n.pos, Msg: "unsupported expression"}
+}
+
+func (c *checker) checkIdent(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	if v := sc.lookup(n.name); v != nil {
+		slot := v.slot
+		return v.typ, func(s *state) (interface{}, error) { return s.vars[slot], s.step() }, nil
+	}
+
+	root, ok := roots[n.name]
+	if !ok {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("unknown name %q", n.name)}
+	}
+	if n.name == "now" {
+		c.usesNow = true
+	}
+	get := root.get
+	return root.typ, func(s *state) (interface{}, error) { return get(s, nil), s.step() }, nil
+}
+
+func (c *checker) checkList(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	if len(n.args) == 0 {
+		return emptyListType, func(s *state) (interface{}, error) { return []interface{}{}, s.step() }, nil
+	}
+
+	var elem *ruleType
+	elements := make([]evalFunc, 0, len(n.args))
+	for _, arg := range n.args {
+		t, eval, err := c.check(arg, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if t.kind == kindList || t.kind == kindObject {
+			return nil, nil, &Error{Pos: arg.pos, Msg: fmt.Sprintf("list elements must be bool, int or string, not %s", t)}
+		}
+		if elem != nil && t != elem {
+			return nil, nil, &Error{Pos: arg.pos, Msg: fmt.Sprintf("list mixes %s and %s elements", elem, t)}
+		}
+		elem = t
+		elements = append(elements, eval)
+	}
+
+	return listOf(elem), func(s *state) (interface{}, error) {
+		if err := s.step(); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(elements))
+		for i, element := range elements {
+			value, err := element(s)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}, nil
+}
+
+func (c *checker) checkField(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	t, target, err := c.check(n.args[0], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.kind != kindObject {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s has no fields", t)}
+	}
+	f, ok := t.fields[n.name]
+	if !ok {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s has no field %q", t, n.name)}
+	}
+
+	get := f.get
+	return f.typ, func(s *state) (interface{}, error) {
+		object, err := target(s)
+		if err != nil {
+			return nil, err
+		}
+		return get(s, object), s.step()
+	}, nil
+}
+
+func (c *checker) checkCall(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	t, target, err := c.check(n.args[0], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	args := n.args[1:]
+
+	switch {
+	case n.name == "size" && (t.kind == kindList || t.kind == kindString):
+		if len(args) != 0 {
+			return nil, nil, &Error{Pos: n.pos, Msg: "size takes no arguments"}
+		}
+		return intType, func(s *state) (interface{}, error) {
+			value, err := target(s)
+			if err != nil {
+				return nil, err
+			}
+			if list, ok := value.([]interface{}); ok {
+				return int64(len(list)), s.step()
+			}
+			return int64(len(value.(string))), s.step()
+		}, nil
+	case (n.name == "contains" || n.name == "startsWith" || n.name == "endsWith") && t.kind == kindString:
+		return c.checkStringMethod(n, target, args, sc)
+	case (n.name == "any" || n.name == "all" || n.name == "count") && t.kind == kindList:
+		return c.checkMacro(n, t, target, args, sc)
+	}
+	return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s has no method %q", t, n.name)}
+}
+
+func (c *checker) checkStringMethod(n *node, target evalFunc, args []*node, sc *scope) (*ruleType, evalFunc, error) {
+	if len(args) != 1 {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s takes one argument", n.name)}
+	}
+	t, arg, err := c.check(args[0], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != stringType {
+		return nil, nil, &Error{Pos: args[0].pos, Msg: fmt.Sprintf("%s takes a string, not %s", n.name, t)}
+	}
+
+	test := map[string]func(string, string) bool{
+		"contains":   strings.Contains,
+		"startsWith": strings.HasPrefix,
+		"endsWith":   strings.HasSuffix,
+	}[n.name]
+	return boolType, func(s *state) (interface{}, error) {
+		value, err := target(s)
+		if err != nil {
+			return nil, err
+		}
+		other, err := arg(s)
+		if err != nil {
+			return nil, err
+		}
+		return test(value.(string), other.(string)), s.step()
+	}, nil
+}
+
+// checkMacro checks any, all and count, which bind a variable to each element
+// of the list in turn and evaluate a predicate
+func (c *checker) checkMacro(n *node, t *ruleType, target evalFunc, args []*node, sc *scope) (*ruleType, evalFunc, error) {
+	if len(args) != 2 || args[0].kind != nodeIdent {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s takes a variable name and a predicate", n.name)}
+	}
+	if t == emptyListType {
+		return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("%s needs a list with elements", n.name)}
+	}
+	name := args[0].name
+	if _, ok := roots[name]; ok || sc.lookup(name) != nil {
+		return nil, nil, &Error{Pos: args[0].pos, Msg: fmt.Sprintf("variable %q is already defined", name)}
+	}
+
+	slot := c.slots
+	c.slots++
+	pt, predicate, err := c.check(args[1], &scope{name: name, typ: t.elem, slot: slot, parent: sc})
+	if err != nil {
+		return nil, nil, err
+	}
+	if pt != boolType {
+		return nil, nil, &Error{Pos: args[1].pos, Msg: fmt.Sprintf("%s predicate must be bool, not %s", n.name, pt)}
+	}
+
+	resultType := boolType
+	if n.name == "count" {
+		resultType = intType
+	}
+	macro := n.name
+	return resultType, func(s *state) (interface{}, error) {
+		value, err := target(s)
+		if err != nil {
+			return nil, err
+		}
+
+		var count int64
+		for _, element := range value.([]interface{}) {
+			s.vars[slot] = element
+			result, err := predicate(s)
+			if err != nil {
+				return nil, err
+			}
+
+			matched := result.(bool)
+			switch {
+			case macro == "any" && matched:
+				return true, nil
+			case macro == "all" && !matched:
+				return false, nil
+			case matched:
+				count++
+			}
+		}
+
+		switch macro {
+		case "any":
+			return false, nil
+		case "all":
+			return true, nil
+		}
+		return count, nil
+	}, nil
+}
+
+func (c *checker) checkUnary(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	t, operand, err := c.check(n.args[0], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case n.name == "!" && t == boolType:
+		return boolType, func(s *state) (interface{}, error) {
+			value, err := operand(s)
+			if err != nil {
+				return nil, err
+			}
+			return !value.(bool), s.step()
+		}, nil
+	case n.name == "-" && t == intType:
+		return intType, func(s *state) (interface{}, error) {
+			value, err := operand(s)
+			if err != nil {
+				return nil, err
+			}
+			return -value.(int64), s.step()
+		}, nil
+	}
+	return nil, nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("operator %s does not apply to %s", n.name, t)}
+}
+
+func (c *checker) checkBinary(n *node, sc *scope) (*ruleType, evalFunc, error) {
+	lt, left, err := c.check(n.args[0], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	rt, right, err := c.check(n.args[1], sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	mismatch := &Error{Pos: n.pos, Msg: fmt.Sprintf("operator %s does not apply to %s and %s", n.name, lt, rt)}
+
+	switch n.name {
+	case "&&", "||":
+		if lt != boolType || rt != boolType {
+			return nil, nil, mismatch
+		}
+		// The right operand is only evaluated when it decides the result
+		short := n.name == "||"
+		return boolType, func(s *state) (interface{}, error) {
+			value, err := left(s)
+			if err != nil || value.(bool) == short {
+				return value, err
+			}
+			if err := s.step(); err != nil {
+				return nil, err
+			}
+			return right(s)
+		}, nil
+	case "==", "!=":
+		if lt != rt || lt.kind == kindList || lt.kind == kindObject {
+			return nil, nil, mismatch
+		}
+		equal := n.name == "=="
+		return boolType, binary(left, right, func(a, b interface{}) interface{} {
+			return (a == b) == equal
+		}), nil
+	case "<", "<=", ">", ">=":
+		if lt != rt || (lt != intType && lt != stringType) {
+			return nil, nil, mismatch
+		}
+		op := n.name
+		return boolType, binary(left, right, func(a, b interface{}) interface{} {
+			cmp := compare(a, b)
+			switch op {
+			case "<":
+				return cmp < 0
+			case "<=":
+				return cmp <= 0
+			case ">":
+				return cmp > 0
+			}
+			return cmp >= 0
+		}), nil
+	case "in":
+		if rt.kind != kindList || !(rt == emptyListType || rt.elem == lt) || lt.kind == kindList || lt.kind == kindObject {
+			return nil, nil, mismatch
+		}
+		return boolType, func(s *state) (interface{}, error) {
+			value, err := left(s)
+			if err != nil {
+				return nil, err
+			}
+			list, err := right(s)
+			if err != nil {
+				return nil, err
+			}
+			for _, element := range list.([]interface{}) {
+				if err := s.step(); err != nil {
+					return nil, err
+				}
+				if element == value {
+					return true, nil
+				}
+			}
+			return false, nil
+		}, nil
+	}
+	return nil, nil, mismatch
+}
+
+// binary evaluates both operands and combines them
+func binary(left, right evalFunc, combine func(a, b interface{}) interface{}) evalFunc {
+	return func(s *state) (interface{}, error) {
+		a, err := left(s)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(s)
+		if err != nil {
+			return nil, err
+		}
+		return combine(a, b), s.step()
+	}
+}
+
+// compare orders two ints or two strings
+func compare(a, b interface{}) int {
+	if x, ok := a.(int64); ok {
+		y := b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
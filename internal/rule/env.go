@@ -0,0 +1,92 @@
+package rule
+
+import (
+	"strings"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// customer holds the customer attributes of a cart
+type customer struct {
+	id     string
+	tier   string
+	orders int
+}
+
+var (
+	itemType = &ruleType{kind: kindObject, name: "item", fields: map[string]*field{
+		"id":         {stringType, func(_ *state, o interface{}) interface{} { return o.(model.CartItem).ID }},
+		"sku":        {stringType, func(_ *state, o interface{}) interface{} { return o.(model.CartItem).SKU }},
+		"brand":      {stringType, func(_ *state, o interface{}) interface{} { return o.(model.CartItem).Brand }},
+		"price":      {intType, func(_ *state, o interface{}) interface{} { return int64(o.(model.CartItem).Price) }},
+		"amount":     {intType, func(_ *state, o interface{}) interface{} { return int64(o.(model.CartItem).Amount()) }},
+		"quantity":   {intType, func(_ *state, o interface{}) interface{} { return int64(o.(model.CartItem).Units()) }},
+		"on_sale":    {boolType, func(_ *state, o interface{}) interface{} { return o.(model.CartItem).OnSale }},
+		"categories": {listOf(stringType), func(_ *state, o interface{}) interface{} { return stringList(o.(model.CartItem).CategoryIDs) }},
+		"category": {stringType, func(_ *state, o interface{}) interface{} {
+			if categories := o.(model.CartItem).CategoryIDs; len(categories) > 0 {
+				return categories[0]
+			}
+			return ""
+		}},
+	}}
+
+	cartType = &ruleType{kind: kindObject, name: "cart", fields: map[string]*field{
+		"total":           {intType, func(_ *state, o interface{}) interface{} { return int64(o.(*model.Cart).Total) }},
+		"subtotal":        {intType, func(_ *state, o interface{}) interface{} { return int64(o.(*model.Cart).Subtotal()) }},
+		"shipping":        {intType, func(_ *state, o interface{}) interface{} { return int64(o.(*model.Cart).Shipping) }},
+		"tax":             {intType, func(_ *state, o interface{}) interface{} { return int64(o.(*model.Cart).Tax) }},
+		"fees":            {intType, func(_ *state, o interface{}) interface{} { return int64(o.(*model.Cart).Fees) }},
+		"currency":        {stringType, func(_ *state, o interface{}) interface{} { return o.(*model.Cart).Currency }},
+		"shipping_method": {stringType, func(_ *state, o interface{}) interface{} { return o.(*model.Cart).ShippingMethod }},
+		"quantity": {intType, func(_ *state, o interface{}) interface{} {
+			var units int64
+			for _, item := range o.(*model.Cart).Items {
+				units += int64(item.Units())
+			}
+			return units
+		}},
+		"items": {listOf(itemType), func(_ *state, o interface{}) interface{} {
+			items := o.(*model.Cart).Items
+			values := make([]interface{}, len(items))
+			for i, item := range items {
+				values[i] = item
+			}
+			return values
+		}},
+	}}
+
+	customerType = &ruleType{kind: kindObject, name: "customer", fields: map[string]*field{
+		"id":     {stringType, func(_ *state, o interface{}) interface{} { return o.(customer).id }},
+		"tier":   {stringType, func(_ *state, o interface{}) interface{} { return o.(customer).tier }},
+		"orders": {intType, func(_ *state, o interface{}) interface{} { return int64(o.(customer).orders) }},
+	}}
+
+	nowType = &ruleType{kind: kindObject, name: "time", fields: map[string]*field{
+		"year":    {intType, func(s *state, _ interface{}) interface{} { return int64(s.env.Now.UTC().Year()) }},
+		"month":   {intType, func(s *state, _ interface{}) interface{} { return int64(s.env.Now.UTC().Month()) }},
+		"day":     {intType, func(s *state, _ interface{}) interface{} { return int64(s.env.Now.UTC().Day()) }},
+		"hour":    {intType, func(s *state, _ interface{}) interface{} { return int64(s.env.Now.UTC().Hour()) }},
+		"minute":  {intType, func(s *state, _ interface{}) interface{} { return int64(s.env.Now.UTC().Minute()) }},
+		"weekday": {stringType, func(s *state, _ interface{}) interface{} { return strings.ToLower(s.env.Now.UTC().Weekday().String()) }},
+	}}
+)
+
+// roots lists the names a rule can refer to, read from the environment
+var roots = map[string]*field{
+	"cart": {cartType, func(s *state, _ interface{}) interface{} { return s.env.Cart }},
+	"customer": {customerType, func(s *state, _ interface{}) interface{} {
+		return customer{id: s.env.Cart.CustomerID, tier: s.env.Cart.CustomerTier, orders: s.env.CustomerOrders}
+	}},
+	"channel": {stringType, func(s *state, _ interface{}) interface{} { return s.env.Cart.Channel }},
+	"now":     {nowType, func(s *state, _ interface{}) interface{} { return nil }},
+}
+
+// stringList converts a string slice into a list value
+func stringList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	return list
+}
@@ -0,0 +1,353 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind classifies a token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokOp
+)
+
+// token represents a lexical token and the offset it starts at
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+}
+
+// operators lists the operator tokens, two-character ones first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "-", "(", ")", "[", "]", ",", "."}
+
+// lex splits the rule into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, pos: start, text: src[start:i]})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokInt, pos: start, text: src[start:i]})
+		case c == '"':
+			start := i
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+				if i < len(src) && src[i] == '\n' {
+					break
+				}
+			}
+			if i >= len(src) || src[i] != '"' {
+				return nil, &Error{Pos: start, Msg: "unterminated string"}
+			}
+			i++
+			text, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, &Error{Pos: start, Msg: "invalid string"}
+			}
+			tokens = append(tokens, token{kind: tokString, pos: start, text: text})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: tokOp, pos: i, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// nodeKind classifies a syntax tree node
+type nodeKind int
+
+const (
+	nodeInt nodeKind = iota
+	nodeString
+	nodeBool
+	nodeIdent
+	nodeList
+	nodeField
+	nodeCall
+	nodeUnary
+	nodeBinary
+)
+
+// node represents an expression. Name is the identifier, field, method or
+// operator; args holds the operands, with the target of a field or method
+// call first, or the elements of a list.
+type node struct {
+	kind    nodeKind
+	pos     int
+	name    string
+	intVal  int64
+	strVal  string
+	boolVal bool
+	args    []*node
+}
+
+// parser is a recursive descent parser over the rule's tokens
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+// parse parses the rule into a syntax tree
+func parse(src string) (*node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the operator
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// expect consumes the operator or fails
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok token) error {
+	if tok.kind == tokEOF {
+		return &Error{Pos: tok.pos, Msg: "unexpected end of rule"}
+	}
+	return &Error{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: nodeBinary, pos: tok.pos, name: "||", args: []*node{left, right}}
+	}
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept("&&") {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: nodeBinary, pos: tok.pos, name: "&&", args: []*node{left, right}}
+	}
+}
+
+// parseComparison parses a comparison, which does not chain
+func (p *parser) parseComparison() (*node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" ||
+		tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+	case tok.kind == tokIdent && tok.text == "in":
+	default:
+		return left, nil
+	}
+	p.advance()
+
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &node{kind: nodeBinary, pos: tok.pos, name: tok.text, args: []*node{left, right}}, nil
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxDepth {
+		return nil, &Error{Pos: p.peek().pos, Msg: fmt.Sprintf("rule is nested deeper than %d", MaxDepth)}
+	}
+
+	tok := p.peek()
+	if p.accept("!") || p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeUnary, pos: tok.pos, name: tok.text, args: []*node{operand}}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix parses a primary expression followed by fields and method calls
+func (p *parser) parsePostfix() (*node, error) {
+	target, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(".") {
+		tok := p.advance()
+		if tok.kind != tokIdent {
+			return nil, p.unexpected(tok)
+		}
+
+		if !p.accept("(") {
+			target = &node{kind: nodeField, pos: tok.pos, name: tok.text, args: []*node{target}}
+			continue
+		}
+
+		call := &node{kind: nodeCall, pos: tok.pos, name: tok.text, args: []*node{target}}
+		if !p.accept(")") {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		target = call
+	}
+	return target, nil
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokInt:
+		value, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, &Error{Pos: tok.pos, Msg: "integer out of range"}
+		}
+		return &node{kind: nodeInt, pos: tok.pos, intVal: value}, nil
+	case tokString:
+		return &node{kind: nodeString, pos: tok.pos, strVal: tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &node{kind: nodeBool, pos: tok.pos, boolVal: tok.text == "true"}, nil
+		case "in":
+			return nil, p.unexpected(tok)
+		}
+		return &node{kind: nodeIdent, pos: tok.pos, name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			list := &node{kind: nodeList, pos: tok.pos}
+			if p.accept("]") {
+				return list, nil
+			}
+			for {
+				element, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.args = append(list.args, element)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+	return nil, p.unexpected(tok)
+}
@@ -0,0 +1,140 @@
+// Package rule implements the expression language of coupon eligibility rules.
+//
+// A rule is a boolean expression over the attributes of the cart, the customer,
+// the sales channel and the current time, such as
+//
+//	cart.items.any(i, i.category == "shoes") && customer.tier in ["gold"]
+//
+// Rules are parsed and type-checked once by Compile and evaluated by
+// Program.Eval. The language has no side effects, no loops other than the list
+// macros and no access to anything but the attributes below, and every
+// evaluation runs under a step budget.
+//
+// Attributes:
+//
+//	cart.total, cart.subtotal, cart.shipping, cart.tax, cart.fees   int (minor units)
+//	cart.quantity                                                   int
+//	cart.currency, cart.shipping_method                             string
+//	cart.items                                                      list of item
+//	item.id, item.sku, item.brand, item.category                    string
+//	item.price, item.amount, item.quantity                          int
+//	item.categories                                                 list of string
+//	item.on_sale                                                    bool
+//	customer.id, customer.tier                                      string
+//	customer.orders                                                 int
+//	channel                                                         string
+//	now.year, now.month, now.day, now.hour, now.minute              int (UTC)
+//	now.weekday                                                     string ("monday")
+//
+// An item's category is the first of its categories. Operators are ||, &&, !,
+// ==, !=, <, <=, >, >=, unary - and in, which tests membership of a list. Lists
+// support size(), any(x, predicate), all(x, predicate) and count(x, predicate),
+// and strings support size(), contains(s), startsWith(s) and endsWith(s).
+//
+// The customer's id and tier and the channel are taken from the cart as the
+// client sent it and are not verified, so a rule on them only restricts clients
+// that report them honestly. customer.orders is counted by the service.
+//
+// A rule reading now can change its result at the start of every minute, which
+// Program.UsesNow reports so that results depending on it are not kept longer.
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+const (
+	// MaxLength is the longest rule accepted, in bytes
+	MaxLength = 2048
+
+	// MaxDepth is the deepest nesting of expressions accepted
+	MaxDepth = 32
+
+	// MaxSteps is the most evaluation steps one evaluation may take. Each
+	// operator, attribute and list element visited is a step.
+	MaxSteps = 10000
+)
+
+// ErrStepLimit is returned when an evaluation exceeds MaxSteps
+var ErrStepLimit = errors.New("rule exceeded its evaluation budget")
+
+// Error represents a rule that does not parse or type-check. Pos is the byte
+// offset in the rule the error was found at.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Pos)
+}
+
+// Env holds the attributes a rule is evaluated against
+type Env struct {
+	Cart *model.Cart
+
+	// CustomerOrders is the number of orders the cart's customer redeemed a
+	// coupon on before
+	CustomerOrders int
+
+	Now time.Time
+}
+
+// Program is a compiled rule. It is safe for concurrent use.
+type Program struct {
+	source  string
+	eval    evalFunc
+	slots   int
+	usesNow bool
+}
+
+// Compile parses and type-checks a rule
+func Compile(source string) (*Program, error) {
+	if len(source) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("rule is longer than %d bytes", MaxLength)}
+	}
+
+	root, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{}
+	t, eval, err := c.check(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t != boolType {
+		return nil, &Error{Pos: root.pos, Msg: fmt.Sprintf("rule must be a bool expression, not %s", t)}
+	}
+
+	return &Program{source: source, eval: eval, slots: c.slots, usesNow: c.usesNow}, nil
+}
+
+// String returns the rule's source
+func (p *Program) String() string {
+	return p.source
+}
+
+// UsesNow reports whether the rule reads the current time
+func (p *Program) UsesNow() bool {
+	return p.usesNow
+}
+
+// Eval reports whether the rule holds for the attributes
+func (p *Program) Eval(env *Env) (bool, error) {
+	s := &state{
+		env:  env,
+		vars: make([]interface{}, p.slots),
+	}
+	value, err := p.eval(s)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
@@ -0,0 +1,148 @@
+package rule
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEnv() *Env {
+	return &Env{
+		Cart: &model.Cart{
+			CustomerID:     "cust-1",
+			CustomerTier:   "gold",
+			Channel:        "mobile",
+			Currency:       "USD",
+			ShippingMethod: "express",
+			Items: []model.CartItem{
+				{ID: "shoe", SKU: "shoe-42", Price: 5000, Quantity: 2, CategoryIDs: []string{"shoes", "sport"}, Brand: "acme"},
+				{ID: "sock", Price: 500, CategoryIDs: []string{"apparel"}, Brand: "globex", OnSale: true},
+			},
+			Shipping: 700,
+			Total:    11200,
+		},
+		CustomerOrders: 3,
+		Now:            time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{`cart.items.any(i, i.category == "shoes") && customer.tier in ["gold"]`, true},
+		{`cart.items.any(i, i.category == "sport")`, false},
+		{`cart.items.any(i, "sport" in i.categories)`, true},
+		{`cart.items.all(i, i.price >= 500)`, true},
+		{`cart.items.count(i, i.brand == "acme" || i.on_sale) == 2`, true},
+		{`cart.total >= 10000 && cart.subtotal == 10500 && cart.shipping == 700`, true},
+		{`cart.quantity > 3`, false},
+		{`cart.items.size() == 2 && cart.currency == "USD"`, true},
+		{`cart.shipping_method != "standard"`, true},
+		{`customer.id.startsWith("cust-") && customer.orders < 5`, true},
+		{`channel in ["web", "mobile"]`, true},
+		{`channel == "pos"`, false},
+		{`now.weekday == "saturday" && now.hour >= 18 && now.month == 3`, true},
+		{`now.year == 2026 && now.day == 14 && now.minute == 30`, true},
+		{`!(cart.total < -1)`, true},
+		{`cart.items.any(i, i.id == "shoe" && i.amount == 10000 && i.quantity == 2 && i.sku.endsWith("42"))`, true},
+		{`cart.items.any(i, cart.items.any(j, i.brand != j.brand))`, true},
+		{`"x" in []`, false},
+		{`customer.tier.contains("ol") && "b" > "a"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			program, err := Compile(tt.rule)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, err := program.Eval(testEnv())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		msg  string
+	}{
+		{`cart.total`, "rule must be a bool expression, not int at offset 5"},
+		{`cart.totals > 0`, `cart has no field "totals" at offset 5`},
+		{`order.total > 0`, `unknown name "order" at offset 0`},
+		{`cart.total > "100"`, "operator > does not apply to int and string at offset 11"},
+		{`customer.tier in [1, 2]`, "operator in does not apply to string and list of int at offset 14"},
+		{`[1, "a"] == []`, `list mixes int and string elements at offset 4`},
+		{`cart.items == cart.items`, "operator == does not apply to list of item and list of item at offset 11"},
+		{`cart.items.any(i, i.price)`, "any predicate must be bool, not int at offset 20"},
+		{`cart.items.any(cart, true)`, `variable "cart" is already defined at offset 15`},
+		{`cart.items.map(i, i.price)`, `list of item has no method "map" at offset 11`},
+		{`cart.total > `, "unexpected end of rule at offset 13"},
+		{`cart.total > 1 > 0`, `unexpected ">" at offset 15`},
+		{`cart.currency == "USD`, "unterminated string at offset 17"},
+		{`cart.total # 1`, "unexpected character '#' at offset 11"},
+		{`cart.total > 99999999999999999999`, "integer out of range at offset 13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := Compile(tt.rule)
+			var ruleErr *Error
+			if assert.ErrorAs(t, err, &ruleErr) {
+				assert.Equal(t, tt.msg, ruleErr.Error())
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	// Rules are bounded in size and nesting when they are compiled
+	_, err := Compile(strings.Repeat(" ", MaxLength) + "true")
+	assert.ErrorContains(t, err, "rule is longer than")
+
+	_, err = Compile(strings.Repeat("(", MaxDepth) + "true" + strings.Repeat(")", MaxDepth))
+	assert.ErrorContains(t, err, "rule is nested deeper than")
+
+	// and in the work one evaluation does
+	program, err := Compile(`cart.items.all(a, cart.items.all(b, cart.items.all(c, a.price >= b.price || a.price < b.price)))`)
+	assert.NoError(t, err)
+
+	env := testEnv()
+	for i := 0; i < 30; i++ {
+		env.Cart.Items = append(env.Cart.Items, model.CartItem{ID: "filler", Price: 100})
+	}
+	_, err = program.Eval(env)
+	assert.ErrorIs(t, err, ErrStepLimit)
+
+	// A smaller cart stays within the budget
+	ok, err := program.Eval(testEnv())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestUsesNow(t *testing.T) {
+	tests := []struct {
+		rule    string
+		usesNow bool
+	}{
+		{`now.weekday == "friday" && now.hour >= 18`, true},
+		{`cart.total > 5000 || now.year > 2030`, true},
+		{`cart.total > 5000`, false},
+		{`cart.items.any(i, i.price > 0)`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			program, err := Compile(tt.rule)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.usesNow, program.UsesNow())
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/cache"
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// The cached result types, named for backends that serialize values
+func init() {
+	cache.Register("applicable_coupons", []*model.ApplicableCoupon{})
+	cache.Register("validation_result", &model.ValidationResult{})
+}
+
+// catalogTag marks cached results that depend on the whole set of coupons
+const catalogTag = "catalog"
+
+// ratesTag marks cached results that converted amounts at the exchange rates
+const ratesTag = "rates"
+
+// couponTag marks cached results that depend on the coupon
+func couponTag(code string) string {
+	return "coupon:" + code
+}
+
+// customerTag marks cached results that depend on the customer's redemption history
+func customerTag(customerID string) string {
+	return "customer:" + customerID
+}
+
+// validityDeadline returns the first start or end date after now among the
+// coupons. Cached results about the coupons go stale then, as one of them starts
+// or stops applying. It is the zero time when none of them changes again.
+func validityDeadline(now time.Time, coupons ...*model.Coupon) time.Time {
+	var deadline time.Time
+	for _, coupon := range coupons {
+		for _, at := range []time.Time{coupon.StartDate, coupon.EndDate} {
+			if at.After(now) && (deadline.IsZero() || at.Before(deadline)) {
+				deadline = at
+			}
+		}
+	}
+	return deadline
+}
+
+// earliest returns the earlier of two deadlines, where the zero time is none
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// generateCacheKey returns a deterministic key for the prefix and params built
+// from a hash of their JSON encoding. The params cannot be cached when they
+// have no JSON encoding.
+func generateCacheKey(prefix string, params ...interface{}) (string, bool) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256(data)
+	return prefix + ":" + hex.EncodeToString(sum[:]), true
+}
+
+// invalidateCoupon drops cached results that depend on the coupon. Set widened
+// when the change can make the coupon apply to carts it did not apply to before,
+// which stales every cached list of applicable coupons.
+func (s *CouponService) invalidateCoupon(code string, widened bool) {
+	s.cache.InvalidateTag(couponTag(code))
+	if widened {
+		s.cache.InvalidateTag(catalogTag)
+	}
+}
+
+// invalidateCustomer drops cached results that depend on the customer's history
+func (s *CouponService) invalidateCustomer(customerID string) {
+	if customerID != "" {
+		s.cache.InvalidateTag(customerTag(customerID))
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"math"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// Config holds the service's settings
+type Config struct {
+	// QualifyShipping, QualifyTax and QualifyFees count the cart's shipping, tax
+	// and fees towards the qualifying total that minimum order values are
+	// checked against. By default only the line items qualify.
+	QualifyShipping bool
+	QualifyTax      bool
+	QualifyFees     bool
+
+	// Rounding is how discount math rounds to whole minor units, half up by default
+	Rounding model.RoundingMode
+}
+
+// maxQuantity bounds the quantity of a cart line
+const maxQuantity = 100000
+
+// checkCart validates the cart's currency, lines and charges and checks that its
+// total matches them, so a client cannot inflate the total to reach a minimum
+// order value. It returns a copy of the cart with an omitted currency resolved
+// to the default one and an omitted total filled in, and leaves the cart itself
+// untouched, as it may be shared by concurrent requests.
+func checkCart(cart *model.Cart) (*model.Cart, error) {
+	currency := cartCurrency(cart)
+	if !model.ValidCurrency(currency) {
+		return nil, ErrInvalidCurrency
+	}
+
+	// Amounts are summed with overflow checks, a wrapped total could pass for any amount
+	var total model.Money
+	for _, item := range cart.Items {
+		if item.Price < 0 || item.Quantity < 0 || item.Quantity > maxQuantity {
+			return nil, ErrInvalidCart
+		}
+		if item.Price > math.MaxInt64/model.Money(item.Units()) {
+			return nil, ErrCartOverflow
+		}
+		if total = addAmount(total, item.Amount()); total < 0 {
+			return nil, ErrCartOverflow
+		}
+	}
+
+	if cart.Shipping < 0 || cart.Tax < 0 || cart.Fees < 0 || cart.Total < 0 {
+		return nil, ErrInvalidCart
+	}
+
+	for _, charge := range []model.Money{cart.Shipping, cart.Tax, cart.Fees} {
+		if total = addAmount(total, charge); total < 0 {
+			return nil, ErrCartOverflow
+		}
+	}
+
+	if cart.Total != 0 && cart.Total != total {
+		return nil, ErrCartTotalMismatch
+	}
+
+	checked := *cart
+	checked.Currency = currency
+	checked.Total = total
+	return &checked, nil
+}
+
+// addAmount adds two non-negative amounts, returning -1 when the sum overflows
+func addAmount(a, b model.Money) model.Money {
+	if b > math.MaxInt64-a {
+		return -1
+	}
+	return a + b
+}
+
+// qualifyingTotal returns the part of the cart total that counts towards
+// minimum order values
+func (s *CouponService) qualifyingTotal(cart *model.Cart) model.Money {
+	total := cart.Subtotal()
+	if s.config.QualifyShipping {
+		total += cart.Shipping
+	}
+	if s.config.QualifyTax {
+		total += cart.Tax
+	}
+	if s.config.QualifyFees {
+		total += cart.Fees
+	}
+	return total
+}
@@ -2,7 +2,7 @@ package service
 
 import (
 	"context"
-	"sync"
+	"fmt"
 	"time"
 
 	"github.com/Sensrdt/coupon-system/internal/cache"
@@ -10,203 +10,834 @@ import (
 )
 
 type CouponService struct {
-	repo  model.Repository
-	cache cache.Cache
-	mu    sync.RWMutex
+	repo   model.Repository
+	cache  cache.Cache
+	config Config
+
+	// rules holds the compiled coupon rules by their source
+	rules cache.Cache
 }
 
 func NewCouponService(repo model.Repository, cache cache.Cache) *CouponService {
+	return NewCouponServiceWithConfig(repo, cache, Config{})
+}
+
+// NewCouponServiceWithConfig creates a CouponService with the given settings
+func NewCouponServiceWithConfig(repo model.Repository, cache cache.Cache, config Config) *CouponService {
+	if config.Rounding == "" {
+		config.Rounding = model.RoundHalfUp
+	}
+
 	return &CouponService{
-		repo:  repo,
-		cache: cache,
+		repo:   repo,
+		cache:  cache,
+		config: config,
+		rules:  newRuleCache(),
 	}
 }
 
-func (s *CouponService) GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.Coupon, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *CouponService) GetApplicableCoupons(ctx context.Context, cart *model.Cart) ([]*model.ApplicableCoupon, error) {
+	cart, err := checkCart(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey, cacheable := generateCacheKey("applicable", cart)
+	if cacheable {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			return cached.([]*model.ApplicableCoupon), nil
+		}
+	}
+
+	// Narrow the candidates in the database, the full rules are checked below.
+	// Coupons that have not started yet are kept, so the cached result can
+	// expire when they start.
+	now := time.Now().UTC()
+	active := true
+	qualifying := s.qualifyingTotal(cart)
+	if len(cart.Items) == 0 {
+		return []*model.ApplicableCoupon{}, nil
+	}
 
-	cacheKey := generateCacheKey("applicable", cart)
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		return cached.([]*model.Coupon), nil
+	filter := &model.CouponFilter{
+		Active:        &active,
+		ValidFrom:     &now,
+		OrderTotal:    &qualifying,
+		OrderCurrency: cart.Currency,
+	}
+	for _, item := range cart.Items {
+		filter.Items = append(filter.Items, item.ID)
+		if item.SKU != "" {
+			filter.Items = append(filter.Items, item.SKU)
+		}
+		filter.Categories = append(filter.Categories, item.CategoryIDs...)
+		if item.Brand != "" {
+			filter.Brands = append(filter.Brands, item.Brand)
+		}
 	}
 
-	coupons, err := s.repo.GetAllCoupons(ctx)
+	coupons, err := s.repo.ListCoupons(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	applicableCoupons := make([]*model.Coupon, 0)
-	now := time.Now()
+	applicableCoupons := make([]*model.ApplicableCoupon, 0)
+
+	usage, err := s.loadUsage(ctx, cart, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.loadRates(ctx, cart, now, coupons...)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, coupon := range coupons {
-		if !coupon.IsActive {
+		if !s.isApplicable(coupon, cart, now, usage, rates) {
 			continue
 		}
 
-		if now.Before(coupon.StartDate) || now.After(coupon.EndDate) {
-			continue
+		discount, err := calculateDiscount(coupon, cart, rates, s.config.Rounding)
+		if err != nil {
+			return nil, err
 		}
 
-		if cart.Total < coupon.MinOrderValue {
-			continue
+		applicableCoupons = append(applicableCoupons, &model.ApplicableCoupon{
+			Coupon:   coupon,
+			Discount: discount,
+		})
+	}
+
+	// Cache the result until the catalog, one of the listed coupons, the customer
+	// or the exchange rates change, or one of the candidates starts or ends or
+	// has a rule on the time that may change
+	if cacheable {
+		tags := []string{catalogTag}
+		for _, applicable := range applicableCoupons {
+			tags = append(tags, couponTag(applicable.Code))
 		}
+		if cart.CustomerID != "" {
+			tags = append(tags, customerTag(cart.CustomerID))
+		}
+		deadline := earliest(validityDeadline(now, coupons...), s.ruleDeadline(now, coupons...))
+		if rates != nil {
+			tags = append(tags, ratesTag)
+			if deadline, err = s.ratesDeadline(ctx, now, deadline); err != nil {
+				return nil, err
+			}
+		}
+		s.cache.SetWithTagsUntil(cacheKey, applicableCoupons, deadline, tags...)
+	}
+
+	return applicableCoupons, nil
+}
+
+// ExplainApplicableCoupons checks every coupon against the cart and reports the
+// applicable ones with their discount and the rejected ones with the rules they
+// failed. The report is meant for troubleshooting and is not cached.
+func (s *CouponService) ExplainApplicableCoupons(ctx context.Context, cart *model.Cart) (*model.ApplicabilityReport, error) {
+	cart, err := checkCart(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	coupons, err := s.repo.ListCoupons(ctx, &model.CouponFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	usage, err := s.loadUsage(ctx, cart, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.loadRates(ctx, cart, now, coupons...)
+	if err != nil {
+		return nil, err
+	}
 
-		if coupon.UsageCount >= coupon.UsageLimit {
+	report := &model.ApplicabilityReport{
+		Applicable: make([]*model.ApplicableCoupon, 0),
+		Rejected:   make([]*model.RejectedCoupon, 0),
+	}
+	for _, coupon := range coupons {
+		if reasons := s.checkRules(coupon, cart, now, usage, rates); len(reasons) > 0 {
+			report.Rejected = append(report.Rejected, &model.RejectedCoupon{Coupon: coupon, Reasons: reasons})
 			continue
 		}
 
-		hasApplicableItem := false
-		for _, item := range cart.Items {
-			for _, applicableItem := range coupon.ApplicableItems {
-				if item.ID == applicableItem {
-					hasApplicableItem = true
-					break
-				}
-			}
-			if hasApplicableItem {
-				break
-			}
+		discount, err := calculateDiscount(coupon, cart, rates, s.config.Rounding)
+		if err != nil {
+			return nil, err
 		}
 
-		if hasApplicableItem {
-			applicableCoupons = append(applicableCoupons, coupon)
-		}
+		report.Applicable = append(report.Applicable, &model.ApplicableCoupon{
+			Coupon:   coupon,
+			Discount: discount,
+		})
 	}
 
-	// Cache the result
-	s.cache.Set(cacheKey, applicableCoupons)
-
-	return applicableCoupons, nil
+	return report, nil
 }
 
-func (s *CouponService) ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (bool, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ValidateCoupon checks whether the coupon applies to the cart and computes its
+// discount. It has no side effects; use RedeemCoupon to consume a use.
+func (s *CouponService) ValidateCoupon(ctx context.Context, code string, cart *model.Cart) (*model.ValidationResult, error) {
+	cart, err := checkCart(cart)
+	if err != nil {
+		return nil, err
+	}
 
-	cacheKey := generateCacheKey("validate", code, cart)
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		return cached.(bool), nil
+	cacheKey, cacheable := generateCacheKey("validate", code, cart)
+	if cacheable {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			return cached.(*model.ValidationResult), nil
+		}
 	}
 
 	coupon, err := s.repo.FindCouponByCode(ctx, code)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if coupon == nil {
-		return false, nil
+		return &model.ValidationResult{
+			Valid:   false,
+			Reasons: []model.Reason{{Code: model.ReasonCouponNotFound, Message: "coupon not found"}},
+		}, nil
 	}
 
 	now := time.Now()
-	if !coupon.IsActive {
-		return false, nil
+	usage, err := s.loadUsage(ctx, cart, now, coupon.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	if now.Before(coupon.StartDate) || now.After(coupon.EndDate) {
-		return false, nil
+	rates, err := s.loadRates(ctx, cart, now, coupon)
+	if err != nil {
+		return nil, err
 	}
 
-	if cart.Total < coupon.MinOrderValue {
-		return false, nil
+	if reasons := s.checkRules(coupon, cart, now, usage, rates); len(reasons) > 0 {
+		return &model.ValidationResult{Valid: false, Reasons: reasons}, nil
 	}
 
-	if coupon.UsageCount >= coupon.UsageLimit {
-		return false, nil
+	discount, err := calculateDiscount(coupon, cart, rates, s.config.Rounding)
+	if err != nil {
+		return nil, err
 	}
 
-	hasApplicableItem := false
-	for _, item := range cart.Items {
-		for _, applicableItem := range coupon.ApplicableItems {
-			if item.ID == applicableItem {
-				hasApplicableItem = true
-				break
+	result := &model.ValidationResult{Valid: true, Discount: discount}
+	if cacheable {
+		tags := []string{couponTag(coupon.Code)}
+		if cart.CustomerID != "" {
+			tags = append(tags, customerTag(cart.CustomerID))
+		}
+		deadline := earliest(validityDeadline(now, coupon), s.ruleDeadline(now, coupon))
+		if rates != nil {
+			tags = append(tags, ratesTag)
+			if deadline, err = s.ratesDeadline(ctx, now, deadline); err != nil {
+				return nil, err
 			}
 		}
-		if hasApplicableItem {
-			break
+		s.cache.SetWithTagsUntil(cacheKey, result, deadline, tags...)
+	}
+
+	return result, nil
+}
+
+// RedeemCoupon consumes one use of the coupon for the order. Redeeming the same
+// order again returns the original redemption without consuming another use.
+func (s *CouponService) RedeemCoupon(ctx context.Context, code string, orderID string, cart *model.Cart) (*model.Redemption, error) {
+	if orderID == "" {
+		return nil, ErrInvalidOrderID
+	}
+
+	cart, err := checkCart(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	existing, err := s.repo.FindRedemptionByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		if existing.CouponID != coupon.ID {
+			return nil, model.ErrOrderRedeemed
 		}
+		return existing, nil
 	}
 
-	if !hasApplicableItem {
-		return false, nil
+	now := time.Now()
+	usage, err := s.loadUsage(ctx, cart, now, coupon.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	coupon.UsageCount++
-	if err := s.repo.UpdateCoupon(ctx, coupon); err != nil {
-		return false, err
+	rates, err := s.loadRates(ctx, cart, now, coupon)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.isApplicable(coupon, cart, now, usage, rates) {
+		return nil, ErrCouponNotApplicable
+	}
+
+	discount, err := calculateDiscount(coupon, cart, rates, s.config.Rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	redemption, err := s.repo.RedeemCoupon(ctx, &model.Redemption{
+		CouponID:   coupon.ID,
+		CouponCode: coupon.Code,
+		OrderID:    orderID,
+		CustomerID: cart.CustomerID,
+		Currency:   discount.Currency,
+		OrderTotal: discount.Subtotal,
+		Discount:   discount.Discount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateCoupon(coupon.Code, false)
+	s.invalidateCustomer(redemption.CustomerID)
+
+	return redemption, nil
+}
+
+// ReverseRedemption reverses the order's redemption after a cancellation or refund.
+// A zero refund amount reverses it fully and gives the use back to the coupon; a
+// partial refund returns the prorated discount to claw back.
+func (s *CouponService) ReverseRedemption(ctx context.Context, orderID string, refundAmount model.Money, reactivate bool) (*model.Reversal, error) {
+	if orderID == "" {
+		return nil, ErrInvalidOrderID
+	}
+
+	if refundAmount < 0 {
+		return nil, ErrInvalidRefundAmount
+	}
+
+	reversal, err := s.repo.ReverseRedemption(ctx, orderID, refundAmount, reactivate, s.config.Rounding)
+	if err != nil {
+		return nil, err
 	}
 
-	s.cache.Set(cacheKey, true)
+	if reversal.Full {
+		s.invalidateCoupon(reversal.CouponCode, true)
+		s.invalidateCustomer(reversal.Redemption.CustomerID)
+	}
 
-	return true, nil
+	return reversal, nil
 }
 
 func (s *CouponService) CreateCoupon(ctx context.Context, coupon *model.Coupon) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if coupon.Currency == "" {
+		coupon.Currency = model.DefaultCurrency
+	}
+	utcDates(coupon)
+
+	if err := checkCouponFields(coupon); err != nil {
+		return err
+	}
+
+	// Create coupon
+	if err := s.repo.CreateCoupon(ctx, coupon); err != nil {
+		return err
+	}
+
+	s.invalidateCoupon(coupon.Code, true)
+
+	return nil
+}
+
+// GetCoupon returns the coupon with the given code
+func (s *CouponService) GetCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	return coupon, nil
+}
+
+// ListCouponsPage returns one page of the coupons matching the query, sorted by
+// creation time unless another sort field is given
+func (s *CouponService) ListCouponsPage(ctx context.Context, query *model.CouponQuery) (*model.CouponPage, error) {
+	switch query.Sort {
+	case "":
+		query.Sort = model.CouponSortCreatedAt
+	case model.CouponSortCreatedAt, model.CouponSortEndDate, model.CouponSortCode:
+	default:
+		return nil, ErrInvalidSortField
+	}
+
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+
+	if query.Limit < 0 || query.Limit > MaxPageSize {
+		return nil, ErrInvalidPageSize
+	}
+
+	return s.repo.ListCouponsPage(ctx, query)
+}
 
+// UpdateCoupon replaces the editable fields of the coupon with the given code.
+// The code, usage count and timestamps are kept.
+func (s *CouponService) UpdateCoupon(ctx context.Context, code string, update *model.Coupon) (*model.Coupon, error) {
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	coupon.DiscountType = update.DiscountType
+	coupon.DiscountValue = update.DiscountValue
+	coupon.DiscountAmount = update.DiscountAmount
+	coupon.MinOrderValue = update.MinOrderValue
+	coupon.MaxDiscount = update.MaxDiscount
+	coupon.Currency = update.Currency
+	coupon.Prices = update.Prices
+	if coupon.Currency == "" {
+		coupon.Currency = model.DefaultCurrency
+	}
+	coupon.StartDate = update.StartDate
+	coupon.EndDate = update.EndDate
+	coupon.UsageLimit = update.UsageLimit
+	coupon.PerCustomerLimit = update.PerCustomerLimit
+	coupon.FirstOrderOnly = update.FirstOrderOnly
+	coupon.Exclusive = update.Exclusive
+	coupon.StackGroup = update.StackGroup
+	coupon.Priority = update.Priority
+	coupon.IsActive = update.IsActive
+	coupon.ApplicableItems = update.ApplicableItems
+	coupon.IncludeCategories = update.IncludeCategories
+	coupon.ExcludeCategories = update.ExcludeCategories
+	coupon.IncludeBrands = update.IncludeBrands
+	coupon.ExcludeBrands = update.ExcludeBrands
+	coupon.ExcludeOnSale = update.ExcludeOnSale
+	coupon.BuyQuantity = update.BuyQuantity
+	coupon.GetQuantity = update.GetQuantity
+	coupon.RewardItems = update.RewardItems
+	coupon.MaxApplications = update.MaxApplications
+	coupon.Tiers = update.Tiers
+	coupon.ShippingMethods = update.ShippingMethods
+	coupon.Rule = update.Rule
+
+	return s.saveCoupon(ctx, coupon)
+}
+
+// PatchCoupon updates only the fields set in the patch
+func (s *CouponService) PatchCoupon(ctx context.Context, code string, patch *model.CouponPatch) (*model.Coupon, error) {
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	applyPatch(coupon, patch)
+
+	return s.saveCoupon(ctx, coupon)
+}
+
+// DeactivateCoupon switches the coupon off without deleting it
+func (s *CouponService) DeactivateCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	inactive := false
+	return s.PatchCoupon(ctx, code, &model.CouponPatch{IsActive: &inactive})
+}
+
+// DeleteCoupon soft deletes the coupon, keeping its redemption history
+func (s *CouponService) DeleteCoupon(ctx context.Context, code string) error {
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	if coupon == nil {
+		return ErrCouponNotFound
+	}
+
+	if err := s.repo.DeleteCoupon(ctx, coupon); err != nil {
+		return err
+	}
+
+	s.invalidateCoupon(coupon.Code, false)
+
+	return nil
+}
+
+// saveCoupon validates and persists an existing coupon
+func (s *CouponService) saveCoupon(ctx context.Context, coupon *model.Coupon) (*model.Coupon, error) {
+	utcDates(coupon)
+	if err := checkCouponFields(coupon); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateCoupon(ctx, coupon); err != nil {
+		return nil, err
+	}
+
+	s.invalidateCoupon(coupon.Code, true)
+
+	return coupon, nil
+}
+
+// utcDates converts the coupon's validity window to UTC. SQLite stores times as
+// text with their offset and compares them as strings, so dates in other zones
+// would not match date filters.
+func utcDates(coupon *model.Coupon) {
+	coupon.StartDate = coupon.StartDate.UTC()
+	coupon.EndDate = coupon.EndDate.UTC()
+}
+
+// applyPatch copies the fields set in the patch onto the coupon
+func applyPatch(coupon *model.Coupon, patch *model.CouponPatch) {
+	if patch.DiscountType != nil {
+		coupon.DiscountType = *patch.DiscountType
+	}
+	if patch.DiscountValue != nil {
+		coupon.DiscountValue = *patch.DiscountValue
+	}
+	if patch.DiscountAmount != nil {
+		coupon.DiscountAmount = *patch.DiscountAmount
+	}
+	if patch.MinOrderValue != nil {
+		coupon.MinOrderValue = *patch.MinOrderValue
+	}
+	if patch.MaxDiscount != nil {
+		coupon.MaxDiscount = *patch.MaxDiscount
+	}
+	if patch.Currency != nil {
+		coupon.Currency = *patch.Currency
+	}
+	if patch.Prices != nil {
+		coupon.Prices = *patch.Prices
+	}
+	if patch.StartDate != nil {
+		coupon.StartDate = *patch.StartDate
+	}
+	if patch.EndDate != nil {
+		coupon.EndDate = *patch.EndDate
+	}
+	if patch.UsageLimit != nil {
+		coupon.UsageLimit = *patch.UsageLimit
+	}
+	if patch.PerCustomerLimit != nil {
+		coupon.PerCustomerLimit = *patch.PerCustomerLimit
+	}
+	if patch.FirstOrderOnly != nil {
+		coupon.FirstOrderOnly = *patch.FirstOrderOnly
+	}
+	if patch.Exclusive != nil {
+		coupon.Exclusive = *patch.Exclusive
+	}
+	if patch.StackGroup != nil {
+		coupon.StackGroup = *patch.StackGroup
+	}
+	if patch.Priority != nil {
+		coupon.Priority = *patch.Priority
+	}
+	if patch.IsActive != nil {
+		coupon.IsActive = *patch.IsActive
+	}
+	if patch.ApplicableItems != nil {
+		coupon.ApplicableItems = *patch.ApplicableItems
+	}
+	if patch.IncludeCategories != nil {
+		coupon.IncludeCategories = *patch.IncludeCategories
+	}
+	if patch.ExcludeCategories != nil {
+		coupon.ExcludeCategories = *patch.ExcludeCategories
+	}
+	if patch.IncludeBrands != nil {
+		coupon.IncludeBrands = *patch.IncludeBrands
+	}
+	if patch.ExcludeBrands != nil {
+		coupon.ExcludeBrands = *patch.ExcludeBrands
+	}
+	if patch.ExcludeOnSale != nil {
+		coupon.ExcludeOnSale = *patch.ExcludeOnSale
+	}
+	if patch.BuyQuantity != nil {
+		coupon.BuyQuantity = *patch.BuyQuantity
+	}
+	if patch.GetQuantity != nil {
+		coupon.GetQuantity = *patch.GetQuantity
+	}
+	if patch.RewardItems != nil {
+		coupon.RewardItems = *patch.RewardItems
+	}
+	if patch.MaxApplications != nil {
+		coupon.MaxApplications = *patch.MaxApplications
+	}
+	if patch.Tiers != nil {
+		coupon.Tiers = *patch.Tiers
+	}
+	if patch.ShippingMethods != nil {
+		coupon.ShippingMethods = *patch.ShippingMethods
+	}
+	if patch.Rule != nil {
+		coupon.Rule = *patch.Rule
+	}
+}
+
+// maxCouponAmount bounds a coupon's amounts, in minor units, far below where
+// discount math on them could overflow
+const maxCouponAmount model.Money = 1e15
+
+// validAmount reports whether a coupon amount is neither negative nor above maxCouponAmount
+func validAmount(amount model.Money) bool {
+	return amount >= 0 && amount <= maxCouponAmount
+}
+
+// checkCouponFields validates the coupon's configuration
+func checkCouponFields(coupon *model.Coupon) error {
 	if coupon.Code == "" {
 		return ErrInvalidCouponCode
 	}
 
-	if coupon.DiscountValue <= 0 {
-		return ErrInvalidDiscountValue
+	switch coupon.DiscountType {
+	case model.DiscountTypeTiered:
+		// Tiered coupons take their discounts from the tiers
+		if err := checkTiers(coupon.Tiers); err != nil {
+			return err
+		}
+	case model.DiscountTypeFreeShipping:
+		// Free shipping takes all of the shipping off and needs no value
+	case model.DiscountTypeFlat, model.DiscountTypeShippingFlat:
+		if coupon.DiscountAmount <= 0 {
+			return ErrInvalidDiscountAmount
+		}
+	case model.DiscountTypePercentage, model.DiscountTypeShippingPercentage,
+		model.DiscountTypeBuyXGetY, model.DiscountTypeCheapestFree:
+		// These take a percent off
+		if coupon.DiscountValue <= 0 || coupon.DiscountValue > 100 {
+			return ErrInvalidDiscountValue
+		}
+	default:
+		return ErrInvalidDiscountType
+	}
+
+	if !validAmount(coupon.DiscountAmount) {
+		return ErrInvalidDiscountAmount
+	}
+
+	if err := checkPromotionFields(coupon); err != nil {
+		return err
 	}
 
-	if coupon.MinOrderValue < 0 {
+	if !validAmount(coupon.MinOrderValue) {
 		return ErrInvalidMinOrderValue
 	}
 
-	if coupon.MaxDiscount < 0 {
+	if !validAmount(coupon.MaxDiscount) {
 		return ErrInvalidMaxDiscount
 	}
 
+	if err := checkPrices(coupon); err != nil {
+		return err
+	}
+
+	if err := checkRule(coupon); err != nil {
+		return err
+	}
+
 	if coupon.UsageLimit <= 0 {
 		return ErrInvalidUsageLimit
 	}
 
+	if coupon.PerCustomerLimit < 0 {
+		return ErrInvalidPerCustomerLimit
+	}
+
 	if coupon.StartDate.After(coupon.EndDate) {
 		return ErrInvalidDateRange
 	}
 
-	// Create coupon
-	if err := s.repo.CreateCoupon(ctx, coupon); err != nil {
-		return err
+	return nil
+}
+
+// checkPromotionFields validates the quantities of a buy-X-get-Y or
+// cheapest-free coupon
+func checkPromotionFields(coupon *model.Coupon) error {
+	if coupon.MaxApplications < 0 {
+		return ErrInvalidMaxApplications
 	}
 
-	// Invalidate cache
-	s.cache.Delete(generateCacheKey("applicable", nil))
+	switch coupon.DiscountType {
+	case model.DiscountTypeBuyXGetY:
+		if coupon.BuyQuantity < 1 {
+			return ErrInvalidBuyQuantity
+		}
+		if coupon.GetQuantity < 1 {
+			return ErrInvalidGetQuantity
+		}
+	case model.DiscountTypeCheapestFree:
+		// The group must hold at least one unit the customer pays for
+		if coupon.BuyQuantity < 2 {
+			return ErrInvalidBuyQuantity
+		}
+		if coupon.GetQuantity < 1 || coupon.GetQuantity >= coupon.BuyQuantity {
+			return ErrInvalidGetQuantity
+		}
+	}
 
 	return nil
 }
 
-// dummy
-func generateCacheKey(prefix string, params ...interface{}) string {
-	return prefix
+// couponUsage holds the usage counts a coupon's limits are checked against
+type couponUsage struct {
+	held           map[uint]int
+	customerUses   map[uint]int
+	customerOrders int
 }
 
-// Error types
-var (
-	ErrInvalidCouponCode    = NewError("invalid coupon code")
-	ErrInvalidDiscountValue = NewError("invalid discount value")
-	ErrInvalidMinOrderValue = NewError("invalid minimum order value")
-	ErrInvalidMaxDiscount   = NewError("invalid maximum discount")
-	ErrInvalidUsageLimit    = NewError("invalid usage limit")
-	ErrInvalidDateRange     = NewError("invalid date range")
-)
+// loadUsage loads active holds and the cart customer's redemption history for the
+// given coupons, or for every coupon when no IDs are given
+func (s *CouponService) loadUsage(ctx context.Context, cart *model.Cart, now time.Time, couponIDs ...uint) (*couponUsage, error) {
+	held, err := s.repo.CountActiveReservations(ctx, now, couponIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &couponUsage{held: held, customerUses: map[uint]int{}}
+	if cart.CustomerID == "" {
+		return usage, nil
+	}
+
+	// The customer's full history is needed to tell whether this is their first order
+	redemptions, err := s.repo.CountCustomerRedemptions(ctx, cart.CustomerID)
+	if err != nil {
+		return nil, err
+	}
 
-// Error represents a service error
-type Error struct {
-	message string
+	usage.customerUses = redemptions
+	for _, count := range redemptions {
+		usage.customerOrders += count
+	}
+	return usage, nil
 }
 
-// NewError creates a new Error
-func NewError(message string) *Error {
-	return &Error{message: message}
+// isApplicable reports whether the coupon can be applied to the cart at the given
+// time, counting held reservations against the usage limit
+func (s *CouponService) isApplicable(coupon *model.Coupon, cart *model.Cart, now time.Time, usage *couponUsage, rates exchangeRates) bool {
+	return len(s.checkRules(coupon, cart, now, usage, rates)) == 0
 }
 
-// Error returns the error message
-func (e *Error) Error() string {
-	return e.message
+// checkRules checks every rule of the coupon against the cart at the given time
+// and returns a reason for each rule the cart fails. Amounts the coupon is not
+// priced in the cart's currency are converted at the rates.
+func (s *CouponService) checkRules(coupon *model.Coupon, cart *model.Cart, now time.Time, usage *couponUsage, rates exchangeRates) []model.Reason {
+	var reasons []model.Reason
+	fail := func(code string, format string, args ...interface{}) {
+		reasons = append(reasons, model.Reason{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !coupon.IsActive {
+		fail(model.ReasonCouponInactive, "coupon is not active")
+	}
+
+	if now.Before(coupon.StartDate) {
+		fail(model.ReasonCouponNotStarted, "coupon is valid from %s", coupon.StartDate.Format(time.RFC3339))
+	}
+
+	if now.After(coupon.EndDate) {
+		fail(model.ReasonCouponExpired, "coupon expired at %s", coupon.EndDate.Format(time.RFC3339))
+	}
+
+	// The coupon's amounts only make sense in a currency it is offered in
+	currency := cartCurrency(cart)
+	priced, _, offered := pricedFor(coupon, currency, rates, s.config.Rounding)
+	if !offered {
+		fail(model.ReasonCurrencyNotOffered, "coupon is not offered in %s", currency)
+	} else if qualifying := s.qualifyingTotal(cart); qualifying < priced.MinOrderValue {
+		fail(model.ReasonMinOrderValueNotMet, "qualifying total %s is below the minimum order value of %s",
+			qualifying.Format(currency), priced.MinOrderValue.Format(currency))
+	}
+
+	if coupon.UsageCount+usage.held[coupon.ID] >= coupon.UsageLimit {
+		fail(model.ReasonUsageLimitReached, "coupon has reached its usage limit of %d", coupon.UsageLimit)
+	}
+
+	if (coupon.PerCustomerLimit > 0 || coupon.FirstOrderOnly) && cart.CustomerID == "" {
+		fail(model.ReasonCustomerRequired, "coupon requires a customer id")
+	}
+
+	if coupon.PerCustomerLimit > 0 && cart.CustomerID != "" && usage.customerUses[coupon.ID] >= coupon.PerCustomerLimit {
+		fail(model.ReasonCustomerLimitReached, "customer has reached the limit of %d uses", coupon.PerCustomerLimit)
+	}
+
+	if coupon.FirstOrderOnly && cart.CustomerID != "" && usage.customerOrders > 0 {
+		fail(model.ReasonNotFirstOrder, "coupon is only valid on a customer's first order")
+	}
+
+	if !hasApplicableItem(coupon, cart) {
+		fail(model.ReasonNoApplicableItems, "no cart item is eligible for the coupon")
+	} else if isPromotion(coupon.DiscountType) && len(promotionRewards(coupon, cart, lineAmounts(cart))) == 0 {
+		fail(model.ReasonPromotionNotMet, "cart does not hold enough units for the buy %d get %d promotion",
+			coupon.BuyQuantity, coupon.GetQuantity)
+	} else if isShippingDiscount(coupon.DiscountType) {
+		if cart.Shipping <= 0 {
+			fail(model.ReasonNoShippingCharge, "cart has no shipping charge to discount")
+		} else if !shippingEligible(coupon, cart) {
+			fail(model.ReasonShippingNotEligible, "shipping method %q is not eligible for the coupon", cart.ShippingMethod)
+		}
+	} else if offered && coupon.DiscountType == model.DiscountTypeTiered {
+		progress := tierProgress(priced.Tiers, eligibleBase(coupon, cart, lineAmounts(cart)))
+		if progress.Reached == nil && progress.Next != nil {
+			fail(model.ReasonTierNotReached, "spend %s more on eligible items to reach the first tier",
+				progress.Remaining.Format(currency))
+		}
+	}
+
+	if ok, err := s.evalRule(coupon, cart, now, usage); err != nil {
+		fail(model.ReasonRuleNotMet, "coupon rule could not be evaluated: %v", err)
+	} else if !ok {
+		fail(model.ReasonRuleNotMet, "cart does not satisfy the coupon rule %s", coupon.Rule)
+	}
+
+	return reasons
 }
+
+// hasApplicableItem reports whether any cart item is applicable for the coupon
+func hasApplicableItem(coupon *model.Coupon, cart *model.Cart) bool {
+	for _, item := range cart.Items {
+		if isApplicableItem(coupon, item) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// DefaultPageSize is the number of coupons listed per page when no limit is given
+	DefaultPageSize = 50
+
+	// MaxPageSize is the largest number of coupons listed per page
+	MaxPageSize = 200
+)
@@ -2,10 +2,14 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/Sensrdt/coupon-system/internal/cache"
 	"github.com/Sensrdt/coupon-system/internal/model"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -29,10 +33,30 @@ func (m *MockCache) Set(key string, value interface{}) {
 	m.Called(key, value)
 }
 
+func (m *MockCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	m.Called(key, value, ttl)
+}
+
+func (m *MockCache) SetWithTags(key string, value interface{}, tags ...string) {
+	m.Called(key, value, tags)
+}
+
+func (m *MockCache) SetWithTagsUntil(key string, value interface{}, deadline time.Time, tags ...string) {
+	m.Called(key, value, deadline, tags)
+}
+
 func (m *MockCache) Delete(key string) {
 	m.Called(key)
 }
 
+func (m *MockCache) InvalidateTag(tag string) {
+	m.Called(tag)
+}
+
+func (m *MockCache) Stats() cache.Stats {
+	return m.Called().Get(0).(cache.Stats)
+}
+
 func (m *MockRepository) CreateCoupon(ctx context.Context, coupon *model.Coupon) error {
 	args := m.Called(ctx, coupon)
 	return args.Error(0)
@@ -56,6 +80,117 @@ func (m *MockRepository) UpdateCoupon(ctx context.Context, coupon *model.Coupon)
 	return args.Error(0)
 }
 
+func (m *MockRepository) ListCoupons(ctx context.Context, filter *model.CouponFilter) ([]*model.Coupon, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*model.Coupon), args.Error(1)
+}
+
+func (m *MockRepository) ListCouponsPage(ctx context.Context, query *model.CouponQuery) (*model.CouponPage, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.CouponPage), args.Error(1)
+}
+
+func (m *MockRepository) DeleteCoupon(ctx context.Context, coupon *model.Coupon) error {
+	args := m.Called(ctx, coupon)
+	return args.Error(0)
+}
+
+func (m *MockRepository) FindRedemptionByOrderID(ctx context.Context, orderID string) (*model.Redemption, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Redemption), args.Error(1)
+}
+
+func (m *MockRepository) RedeemCoupon(ctx context.Context, redemption *model.Redemption) (*model.Redemption, error) {
+	args := m.Called(ctx, redemption)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Redemption), args.Error(1)
+}
+
+func (m *MockRepository) ReserveCoupon(ctx context.Context, reservation *model.Reservation) error {
+	args := m.Called(ctx, reservation)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CommitReservation(ctx context.Context, id string, orderID string) (*model.Redemption, error) {
+	args := m.Called(ctx, id, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Redemption), args.Error(1)
+}
+
+func (m *MockRepository) ReleaseReservation(ctx context.Context, id string) (*model.Reservation, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Reservation), args.Error(1)
+}
+
+func (m *MockRepository) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) CountActiveReservations(ctx context.Context, now time.Time, couponIDs ...uint) (map[uint]int, error) {
+	args := m.Called(ctx, now, couponIDs)
+	return args.Get(0).(map[uint]int), args.Error(1)
+}
+
+func (m *MockRepository) CountCustomerRedemptions(ctx context.Context, customerID string, couponIDs ...uint) (map[uint]int, error) {
+	args := m.Called(ctx, customerID, couponIDs)
+	return args.Get(0).(map[uint]int), args.Error(1)
+}
+
+func (m *MockRepository) ReverseRedemption(ctx context.Context, orderID string, refundAmount model.Money, reactivate bool, rounding model.RoundingMode) (*model.Reversal, error) {
+	args := m.Called(ctx, orderID, refundAmount, reactivate, rounding)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Reversal), args.Error(1)
+}
+
+func (m *MockRepository) ListLedgerEntries(ctx context.Context, filter *model.LedgerFilter) ([]*model.LedgerEntry, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*model.LedgerEntry), args.Error(1)
+}
+
+func (m *MockRepository) LedgerUsageCounts(ctx context.Context) (map[uint]int, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[uint]int), args.Error(1)
+}
+
+func (m *MockRepository) SyncUsageCount(ctx context.Context, couponID uint) (int, error) {
+	args := m.Called(ctx, couponID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) SaveExchangeRates(ctx context.Context, rates []*model.ExchangeRate) error {
+	args := m.Called(ctx, rates)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListExchangeRates(ctx context.Context, at time.Time) ([]*model.ExchangeRate, error) {
+	args := m.Called(ctx, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.ExchangeRate), args.Error(1)
+}
+
+func (m *MockRepository) NextExchangeRateAt(ctx context.Context, after time.Time) (time.Time, error) {
+	args := m.Called(ctx, after)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
 func setupTestService(t *testing.T) (*CouponService, *MockRepository, *MockCache) {
 	mockRepo := new(MockRepository)
 	mockCache := new(MockCache)
@@ -73,8 +208,8 @@ func TestGetApplicableCoupons(t *testing.T) {
 			Code:            "TEST10",
 			DiscountType:    "percentage",
 			DiscountValue:   10,
-			MinOrderValue:   100,
-			MaxDiscount:     50,
+			MinOrderValue:   10000,
+			MaxDiscount:     5000,
 			StartDate:       time.Now(),
 			EndDate:         time.Now().Add(24 * time.Hour),
 			UsageLimit:      100,
@@ -85,16 +220,19 @@ func TestGetApplicableCoupons(t *testing.T) {
 	}
 
 	// Setup expectations
-	mockRepo.On("GetAllCoupons", ctx).Return(coupons, nil)
+	mockRepo.On("ListCoupons", ctx, mock.MatchedBy(func(f *model.CouponFilter) bool {
+		return *f.Active && f.ValidFrom != nil && f.ValidTo == nil && *f.OrderTotal == 15000 && f.Items[0] == "item1"
+	})).Return(coupons, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
 	mockCache.On("Get", mock.Anything).Return(nil, false)
-	mockCache.On("Set", mock.Anything, mock.Anything).Return()
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, mock.Anything, []string{"catalog", "coupon:TEST10"}).Return()
 
 	// Test data
 	cart := &model.Cart{
 		Items: []model.CartItem{
-			{ID: "item1", Price: 150},
+			{ID: "item1", Price: 15000},
 		},
-		Total: 150,
+		Total: 15000,
 	}
 
 	// Execute test
@@ -102,6 +240,8 @@ func TestGetApplicableCoupons(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, applicableCoupons, 1)
 	assert.Equal(t, "TEST10", applicableCoupons[0].Code)
+	assert.Equal(t, model.Money(1500), applicableCoupons[0].Discount.Discount)
+	assert.Equal(t, model.Money(13500), applicableCoupons[0].Discount.Total)
 
 	mockRepo.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
@@ -116,8 +256,8 @@ func TestValidateCoupon(t *testing.T) {
 		Code:            "TEST10",
 		DiscountType:    "percentage",
 		DiscountValue:   10,
-		MinOrderValue:   100,
-		MaxDiscount:     50,
+		MinOrderValue:   10000,
+		MaxDiscount:     5000,
 		StartDate:       time.Now(),
 		EndDate:         time.Now().Add(24 * time.Hour),
 		UsageLimit:      100,
@@ -128,38 +268,280 @@ func TestValidateCoupon(t *testing.T) {
 
 	// Setup expectations
 	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil)
-	mockRepo.On("UpdateCoupon", ctx, mock.AnythingOfType("*model.Coupon")).Return(nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
 	mockCache.On("Get", mock.Anything).Return(nil, false)
-	mockCache.On("Set", mock.Anything, true).Return()
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.AnythingOfType("*model.ValidationResult"), mock.Anything, mock.Anything).Return()
 
 	// Test data
 	cart := &model.Cart{
 		Items: []model.CartItem{
-			{ID: "item1", Price: 150},
+			{ID: "item1", Price: 15000},
 		},
-		Total: 150,
+		Total: 15000,
 	}
 
 	// Execute test
-	valid, err := service.ValidateCoupon(ctx, "TEST10", cart)
+	result, err := service.ValidateCoupon(ctx, "TEST10", cart)
 	assert.NoError(t, err)
-	assert.True(t, valid)
+	assert.True(t, result.Valid)
+	assert.Equal(t, model.Money(1500), result.Discount.Discount)
+	assert.Equal(t, 0, coupon.UsageCount)
 
+	mockRepo.AssertNotCalled(t, "UpdateCoupon", mock.Anything, mock.Anything)
 	mockRepo.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
 }
 
-func TestCreateCoupon(t *testing.T) {
+func TestValidateCouponReasons(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		ID:              1,
+		Code:            "OLD",
+		DiscountType:    "flat",
+		DiscountAmount:  1000,
+		MinOrderValue:   10000,
+		StartDate:       time.Now().Add(-48 * time.Hour),
+		EndDate:         time.Now().Add(-24 * time.Hour),
+		UsageLimit:      5,
+		UsageCount:      5,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+
+	mockRepo.On("FindCouponByCode", ctx, "OLD").Return(coupon, nil)
+	mockRepo.On("FindCouponByCode", ctx, "MISSING").Return(nil, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, []uint{1}).Return(map[uint]int{}, nil)
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+
+	codes := func(result *model.ValidationResult) []string {
+		codes := make([]string, 0, len(result.Reasons))
+		for _, reason := range result.Reasons {
+			assert.NotEmpty(t, reason.Message)
+			codes = append(codes, reason.Code)
+		}
+		return codes
+	}
+
+	// Every failed rule is reported
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item2", Price: 5000}}, Total: 5000}
+	result, err := service.ValidateCoupon(ctx, "OLD", cart)
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Nil(t, result.Discount)
+	assert.Equal(t, []string{
+		model.ReasonCouponExpired,
+		model.ReasonMinOrderValueNotMet,
+		model.ReasonUsageLimitReached,
+		model.ReasonNoApplicableItems,
+	}, codes(result))
+	assert.Equal(t, "qualifying total 50.00 USD is below the minimum order value of 100.00 USD", result.Reasons[1].Message)
+
+	result, err = service.ValidateCoupon(ctx, "MISSING", cart)
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []string{model.ReasonCouponNotFound}, codes(result))
+
+	// Invalid results are not cached
+	mockCache.AssertNotCalled(t, "SetWithTagsUntil", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestExplainApplicableCoupons(t *testing.T) {
+	service, mockRepo, _ := setupTestService(t)
+	ctx := context.Background()
+
+	coupons := []*model.Coupon{
+		{
+			ID:              1,
+			Code:            "TEST10",
+			DiscountType:    "percentage",
+			DiscountValue:   10,
+			StartDate:       time.Now().Add(-time.Hour),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			IsActive:        true,
+			ApplicableItems: []string{"item1"},
+		},
+		{
+			ID:              2,
+			Code:            "SOON",
+			DiscountType:    "flat",
+			DiscountAmount:  500,
+			StartDate:       time.Now().Add(time.Hour),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			IsActive:        false,
+			ApplicableItems: []string{"item1"},
+		},
+		{
+			ID:              3,
+			Code:            "WELCOME",
+			DiscountType:    "flat",
+			DiscountAmount:  1000,
+			StartDate:       time.Now().Add(-time.Hour),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			FirstOrderOnly:  true,
+			IsActive:        true,
+			ApplicableItems: []string{"item1"},
+		},
+	}
+
+	// Explaining looks at every coupon, not only the database's candidates
+	mockRepo.On("ListCoupons", ctx, &model.CouponFilter{}).Return(coupons, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, []uint(nil)).Return(map[uint]int{}, nil)
+	mockRepo.On("CountCustomerRedemptions", ctx, "returning-customer", []uint(nil)).Return(map[uint]int{1: 1}, nil)
+
+	cart := &model.Cart{CustomerID: "returning-customer", Items: []model.CartItem{{ID: "item1", Price: 15000}}, Total: 15000}
+	report, err := service.ExplainApplicableCoupons(ctx, cart)
+	assert.NoError(t, err)
+
+	if assert.Len(t, report.Applicable, 1) {
+		assert.Equal(t, "TEST10", report.Applicable[0].Code)
+		assert.Equal(t, model.Money(1500), report.Applicable[0].Discount.Discount)
+	}
+
+	if assert.Len(t, report.Rejected, 2) {
+		assert.Equal(t, "SOON", report.Rejected[0].Code)
+		assert.Equal(t, model.ReasonCouponInactive, report.Rejected[0].Reasons[0].Code)
+		assert.Equal(t, model.ReasonCouponNotStarted, report.Rejected[0].Reasons[1].Code)
+		assert.Equal(t, "WELCOME", report.Rejected[1].Code)
+		assert.Equal(t, []model.Reason{{Code: model.ReasonNotFirstOrder, Message: "coupon is only valid on a customer's first order"}},
+			report.Rejected[1].Reasons)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBestCoupons(t *testing.T) {
+	newCoupon := func(id uint, code string, discountType string, value float64, amount model.Money) *model.Coupon {
+		return &model.Coupon{
+			ID:              id,
+			Code:            code,
+			DiscountType:    discountType,
+			DiscountValue:   value,
+			DiscountAmount:  amount,
+			StartDate:       time.Now().Add(-time.Hour),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			IsActive:        true,
+			ApplicableItems: []string{"item1", "item2"},
+		}
+	}
+
+	percent := newCoupon(1, "P20", "percentage", 20, 0)
+	percent.Priority = 10
+	percent.StackGroup = "promo"
+	flat := newCoupon(2, "F15", "flat", 0, 1500)
+	flat.Priority = 5
+	flat.StackGroup = "promo"
+	exclusive := newCoupon(3, "BIG", "flat", 0, 3000)
+	exclusive.Exclusive = true
+	vip := newCoupon(4, "VIP", "flat", 0, 2500)
+	vip.StackGroup = "vip"
+
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 6000}, {ID: "item2", Price: 4000}}, Total: 10000}
+
+	best := func(coupons ...*model.Coupon) *model.CouponCombination {
+		service, mockRepo, mockCache := setupTestService(t)
+		ctx := context.Background()
+
+		mockRepo.On("ListCoupons", ctx, mock.AnythingOfType("*model.CouponFilter")).Return(coupons, nil)
+		mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+		mockCache.On("Get", mock.Anything).Return(nil, false)
+		mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		combination, err := service.BestCoupons(ctx, cart)
+		assert.NoError(t, err)
+		return combination
+	}
+
+	codes := func(combination *model.CouponCombination) []string {
+		codes := make([]string, 0, len(combination.Coupons))
+		for _, coupon := range combination.Coupons {
+			codes = append(codes, coupon.Code)
+		}
+		return codes
+	}
+
+	// Stacking P20 then F15 (20 + 15) beats BIG (30) and VIP (25), which stack with neither
+	combination := best(flat, exclusive, vip, percent)
+	assert.Equal(t, []string{"P20", "F15"}, codes(combination))
+	assert.Equal(t, model.Money(2000), combination.Coupons[0].Discount.Discount)
+	assert.Equal(t, model.Money(1500), combination.Coupons[1].Discount.Discount)
+	assert.Equal(t, model.Money(8000), combination.Coupons[1].Discount.Subtotal)
+	assert.Equal(t, &model.DiscountResult{
+		Currency:            model.DefaultCurrency,
+		Subtotal:            10000,
+		Discount:            3500,
+		MerchandiseDiscount: 3500,
+		Total:               6500,
+		Items: []model.ItemDiscount{
+			{ID: "item1", Price: 6000, Quantity: 1, Discount: 2100, Total: 3900},
+			{ID: "item2", Price: 4000, Quantity: 1, Discount: 1400, Total: 2600},
+		},
+	}, combination.Discount)
+
+	// Priority decides the order: F15 first leaves 85 for P20 (15 + 17)
+	flat.Priority = 20
+	combination = best(flat, percent)
+	assert.Equal(t, []string{"F15", "P20"}, codes(combination))
+	assert.Equal(t, model.Money(3200), combination.Discount.Discount)
+
+	// An exclusive coupon wins when it beats every stack
+	exclusive.DiscountAmount = 4000
+	combination = best(flat, exclusive, percent)
+	assert.Equal(t, []string{"BIG"}, codes(combination))
+	assert.Equal(t, model.Money(6000), combination.Discount.Total)
+
+	// Coupons without a stack group are not combined, so P20 alone (20) beats F15 (15)
+	percent.StackGroup, flat.StackGroup = "", ""
+	combination = best(flat, percent)
+	assert.Equal(t, []string{"P20"}, codes(combination))
+	assert.Equal(t, model.Money(2000), combination.Discount.Discount)
+
+	// Only the coupons of a group with the largest discounts are combined
+	group := make([]*model.Coupon, 0, MaxStackCandidates+5)
+	for i := 0; i < MaxStackCandidates+5; i++ {
+		coupon := newCoupon(uint(10+i), fmt.Sprintf("G%02d", i), "flat", 0, model.Money(100*(i+1)))
+		coupon.StackGroup = "big"
+		group = append(group, coupon)
+	}
+	combination = best(group...)
+	assert.Equal(t, []string{"G12", "G13", "G14"}, codes(combination))
+	assert.Equal(t, model.Money(4200), combination.Discount.Discount)
+
+	// Without applicable coupons the combination is empty
+	combination = best()
+	assert.Empty(t, combination.Coupons)
+	assert.Equal(t, model.Money(0), combination.Discount.Discount)
+	assert.Equal(t, model.Money(10000), combination.Discount.Total)
+}
+
+func TestTopCandidates(t *testing.T) {
+	a := &model.Coupon{Code: "A", Priority: 3}
+	b := &model.Coupon{Code: "B", Priority: 2}
+	c := &model.Coupon{Code: "C", Priority: 1}
+	d := &model.Coupon{Code: "D"}
+	discounts := map[*model.Coupon]model.Money{a: 100, b: 300, c: 200, d: 200}
+
+	// The largest discounts are kept in priority order, ties going to the higher priority
+	assert.Equal(t, []*model.Coupon{b, c}, topCandidates([]*model.Coupon{a, b, c, d}, discounts, 2))
+	assert.Equal(t, []*model.Coupon{a, b, c, d}, topCandidates([]*model.Coupon{a, b, c, d}, discounts, 4))
+}
+
+func TestRedeemCoupon(t *testing.T) {
 	service, mockRepo, mockCache := setupTestService(t)
 	ctx := context.Background()
 
-	// Test data
 	coupon := &model.Coupon{
+		ID:              1,
 		Code:            "TEST10",
 		DiscountType:    "percentage",
 		DiscountValue:   10,
-		MinOrderValue:   100,
-		MaxDiscount:     50,
+		MinOrderValue:   10000,
+		MaxDiscount:     5000,
 		StartDate:       time.Now(),
 		EndDate:         time.Now().Add(24 * time.Hour),
 		UsageLimit:      100,
@@ -168,12 +550,1447 @@ func TestCreateCoupon(t *testing.T) {
 		ApplicableItems: []string{"item1"},
 	}
 
-	// Setup expectations
-	mockRepo.On("CreateCoupon", ctx, coupon).Return(nil)
-	mockCache.On("Delete", mock.Anything).Return()
+	cart := &model.Cart{
+		Items: []model.CartItem{
+			{ID: "item1", Price: 15000},
+		},
+		Total: 15000,
+	}
 
-	// Execute test
-	err := service.CreateCoupon(ctx, coupon)
+	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockRepo.On("FindRedemptionByOrderID", ctx, "order-1").Return(nil, nil)
+	mockRepo.On("RedeemCoupon", ctx, mock.MatchedBy(func(r *model.Redemption) bool {
+		return r.CouponID == 1 && r.OrderID == "order-1" && r.Discount == 1500
+	})).Return(&model.Redemption{ID: 1, CouponID: 1, OrderID: "order-1", Discount: 1500}, nil)
+	// Only results involving the redeemed coupon are dropped
+	mockCache.On("InvalidateTag", "coupon:TEST10").Return().Once()
+
+	redemption, err := service.RedeemCoupon(ctx, "TEST10", "order-1", cart)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", redemption.OrderID)
+	assert.Equal(t, model.Money(1500), redemption.Discount)
+
+	_, err = service.RedeemCoupon(ctx, "TEST10", "", cart)
+	assert.Equal(t, ErrInvalidOrderID, err)
+
+	mockRepo.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestRedeemCouponIdempotent(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	// The coupon is exhausted by the order being replayed
+	coupon := &model.Coupon{
+		ID:              1,
+		Code:            "ONCE",
+		DiscountType:    "flat",
+		DiscountAmount:  1000,
+		StartDate:       time.Now(),
+		EndDate:         time.Now().Add(24 * time.Hour),
+		UsageLimit:      1,
+		UsageCount:      1,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+	existing := &model.Redemption{ID: 7, CouponID: 1, OrderID: "order-1", Discount: 1000}
+
+	mockRepo.On("FindCouponByCode", ctx, "ONCE").Return(coupon, nil)
+	mockRepo.On("FindRedemptionByOrderID", ctx, "order-1").Return(existing, nil)
+
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 5000}}, Total: 5000}
+	redemption, err := service.RedeemCoupon(ctx, "ONCE", "order-1", cart)
+	assert.NoError(t, err)
+	assert.Equal(t, existing, redemption)
+
+	mockRepo.AssertNotCalled(t, "RedeemCoupon", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestReverseRedemption(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	mockRepo.On("ReverseRedemption", ctx, "order-1", model.Money(0), true, model.RoundHalfUp).
+		Return(&model.Reversal{
+			OrderID:     "order-1",
+			CouponCode:  "ONCE",
+			Full:        true,
+			Reactivated: true,
+			Redemption:  &model.Redemption{OrderID: "order-1", CouponCode: "ONCE", CustomerID: "cust-1"},
+		}, nil)
+	// The use given back can make the coupon reappear in cached lists
+	mockCache.On("InvalidateTag", "coupon:ONCE").Return().Once()
+	mockCache.On("InvalidateTag", "catalog").Return().Once()
+	mockCache.On("InvalidateTag", "customer:cust-1").Return().Once()
+
+	reversal, err := service.ReverseRedemption(ctx, "order-1", 0, true)
+	assert.NoError(t, err)
+	assert.True(t, reversal.Reactivated)
+
+	_, err = service.ReverseRedemption(ctx, "order-1", -10, false)
+	assert.Equal(t, ErrInvalidRefundAmount, err)
+
+	_, err = service.ReverseRedemption(ctx, "", 0, false)
+	assert.Equal(t, ErrInvalidOrderID, err)
+
+	mockRepo.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestReservationLifecycle(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		ID:              1,
+		Code:            "LAST",
+		DiscountType:    "flat",
+		DiscountAmount:  1000,
+		StartDate:       time.Now(),
+		EndDate:         time.Now().Add(24 * time.Hour),
+		UsageLimit:      2,
+		UsageCount:      1,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 5000}}, Total: 5000}
+
+	mockRepo.On("FindCouponByCode", ctx, "LAST").Return(coupon, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, []uint{1}).Return(map[uint]int{}, nil).Once()
+	mockRepo.On("ReserveCoupon", ctx, mock.MatchedBy(func(r *model.Reservation) bool {
+		return r.ID != "" && r.CouponID == 1 && r.Status == model.ReservationStatusActive && r.Discount == 1000
+	})).Return(nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	// Reserve the last use
+	reservation, err := service.ReserveCoupon(ctx, "LAST", cart, time.Minute)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), reservation.ExpiresAt, 5*time.Second)
+
+	// The active hold makes the coupon unavailable to other checkouts
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, []uint{1}).Return(map[uint]int{1: 1}, nil)
+	_, err = service.ReserveCoupon(ctx, "LAST", cart, time.Minute)
+	assert.Equal(t, ErrCouponNotApplicable, err)
+
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+	result, err := service.ValidateCoupon(ctx, "LAST", cart)
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+
+	// Commit the hold to an order
+	mockRepo.On("CommitReservation", ctx, reservation.ID, "order-1").
+		Return(&model.Redemption{ID: 1, CouponID: 1, CouponCode: "LAST", OrderID: "order-1"}, nil)
+	redemption, err := service.CommitReservation(ctx, reservation.ID, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", redemption.OrderID)
+
+	_, err = service.ReserveCoupon(ctx, "LAST", cart, 48*time.Hour)
+	assert.Equal(t, ErrInvalidReservationTTL, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCustomerLimits(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupons := []*model.Coupon{
+		{
+			ID:               1,
+			Code:             "ONCEEACH",
+			DiscountType:     "flat",
+			DiscountAmount:   500,
+			StartDate:        time.Now(),
+			EndDate:          time.Now().Add(24 * time.Hour),
+			UsageLimit:       100,
+			PerCustomerLimit: 1,
+			IsActive:         true,
+			ApplicableItems:  []string{"item1"},
+		},
+		{
+			ID:              2,
+			Code:            "WELCOME",
+			DiscountType:    "flat",
+			DiscountAmount:  1000,
+			StartDate:       time.Now(),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			FirstOrderOnly:  true,
+			IsActive:        true,
+			ApplicableItems: []string{"item1"},
+		},
+	}
+
+	mockRepo.On("ListCoupons", ctx, mock.AnythingOfType("*model.CouponFilter")).Return(coupons, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockRepo.On("CountCustomerRedemptions", ctx, "new-customer", []uint(nil)).Return(map[uint]int{}, nil)
+	mockRepo.On("CountCustomerRedemptions", ctx, "returning-customer", []uint(nil)).Return(map[uint]int{1: 1}, nil)
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	codes := func(customerID string) []string {
+		cart := &model.Cart{CustomerID: customerID, Items: []model.CartItem{{ID: "item1", Price: 5000}}, Total: 5000}
+		applicable, err := service.GetApplicableCoupons(ctx, cart)
+		assert.NoError(t, err)
+
+		result := make([]string, 0, len(applicable))
+		for _, coupon := range applicable {
+			result = append(result, coupon.Code)
+		}
+		return result
+	}
+
+	// Customer-restricted coupons need a customer
+	assert.Empty(t, codes(""))
+	assert.Equal(t, []string{"ONCEEACH", "WELCOME"}, codes("new-customer"))
+	assert.Empty(t, codes("returning-customer"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestReconcileUsage(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupons := []*model.Coupon{
+		{ID: 1, Code: "INSYNC", UsageCount: 2},
+		{ID: 2, Code: "DRIFTED", UsageCount: 5},
+	}
+
+	mockRepo.On("GetAllCoupons", ctx).Return(coupons, nil)
+	mockRepo.On("LedgerUsageCounts", ctx).Return(map[uint]int{1: 2, 2: 3}, nil)
+
+	// Report only
+	drifts, err := service.ReconcileUsage(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.UsageDrift{{CouponID: 2, Code: "DRIFTED", UsageCount: 5, LedgerCount: 3}}, drifts)
+	mockRepo.AssertNotCalled(t, "SyncUsageCount", mock.Anything, mock.Anything)
+
+	// Fix, with a redemption recorded after the ledger was read
+	mockRepo.On("SyncUsageCount", ctx, uint(2)).Return(4, nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	drifts, err = service.ReconcileUsage(ctx, true)
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 1)
+	assert.True(t, drifts[0].Fixed)
+	assert.Equal(t, 4, drifts[0].LedgerCount)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateCoupon(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	// Test data
+	coupon := &model.Coupon{
+		Code:            "TEST10",
+		DiscountType:    "percentage",
+		DiscountValue:   10,
+		MinOrderValue:   10000,
+		MaxDiscount:     5000,
+		StartDate:       time.Now(),
+		EndDate:         time.Now().Add(24 * time.Hour),
+		UsageLimit:      100,
+		UsageCount:      0,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+
+	// Setup expectations
+	mockRepo.On("CreateCoupon", ctx, coupon).Return(nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	// Execute test
+	err := service.CreateCoupon(ctx, coupon)
+	assert.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestCreateCouponInvalidDiscountType(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		Code:            "TEST10",
+		DiscountType:    "bogus",
+		DiscountValue:   10,
+		StartDate:       time.Now(),
+		EndDate:         time.Now().Add(24 * time.Hour),
+		UsageLimit:      100,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+
+	err := service.CreateCoupon(ctx, coupon)
+	assert.Equal(t, ErrInvalidDiscountType, err)
+
+	mockRepo.AssertNotCalled(t, "CreateCoupon", mock.Anything, mock.Anything)
+	mockCache.AssertNotCalled(t, "InvalidateTag", mock.Anything)
+}
+
+func TestCouponAmountBounds(t *testing.T) {
+	valid := func() *model.Coupon {
+		return &model.Coupon{Code: "BIG", DiscountType: model.DiscountTypeFlat, DiscountAmount: maxCouponAmount,
+			MinOrderValue: maxCouponAmount, MaxDiscount: maxCouponAmount, StartDate: time.Now(),
+			EndDate: time.Now().Add(time.Hour), UsageLimit: 1}
+	}
+	assert.NoError(t, checkCouponFields(valid()))
+
+	tests := []struct {
+		name   string
+		modify func(c *model.Coupon)
+		err    error
+	}{
+		{"discount amount", func(c *model.Coupon) { c.DiscountAmount++ }, ErrInvalidDiscountAmount},
+		{"minimum order value", func(c *model.Coupon) { c.MinOrderValue++ }, ErrInvalidMinOrderValue},
+		{"maximum discount", func(c *model.Coupon) { c.MaxDiscount++ }, ErrInvalidMaxDiscount},
+		{"price", func(c *model.Coupon) {
+			c.Prices = []model.CouponPrice{{Currency: "EUR", DiscountAmount: maxCouponAmount + 1}}
+		}, ErrInvalidPrices},
+		{"tier", func(c *model.Coupon) {
+			c.DiscountType = model.DiscountTypeTiered
+			c.DiscountAmount = 0
+			c.Tiers = []model.DiscountTier{{MinSpend: maxCouponAmount + 1, DiscountType: model.DiscountTypeFlat, DiscountAmount: 500}}
+		}, ErrInvalidTiers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := valid()
+			tt.modify(coupon)
+			assert.Equal(t, tt.err, checkCouponFields(coupon))
+		})
+	}
+}
+
+func TestCouponDatesUTC(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	// Dates sent with an offset are stored in UTC, which SQLite needs to compare them
+	est := time.FixedZone("EST", -5*60*60)
+	start := time.Now().Add(-time.Hour).In(est)
+	end := time.Now().Add(3 * time.Hour).In(est)
+	inUTC := func(c *model.Coupon) bool {
+		return c.StartDate.Location() == time.UTC && c.EndDate.Location() == time.UTC
+	}
+
+	coupon := &model.Coupon{Code: "TEST10", DiscountType: "percentage", DiscountValue: 10,
+		StartDate: start, EndDate: end, UsageLimit: 100, IsActive: true}
+	mockRepo.On("CreateCoupon", ctx, mock.MatchedBy(inUTC)).Return(nil)
+	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil)
+	mockRepo.On("UpdateCoupon", ctx, mock.MatchedBy(inUTC)).Return(nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	assert.NoError(t, service.CreateCoupon(ctx, coupon))
+	assert.True(t, coupon.StartDate.Equal(start))
+	assert.True(t, coupon.EndDate.Equal(end))
+
+	later := end.Add(time.Hour)
+	_, err := service.PatchCoupon(ctx, "TEST10", &model.CouponPatch{EndDate: &later})
+	assert.NoError(t, err)
+
+	_, err = service.UpdateCoupon(ctx, "TEST10", &model.Coupon{DiscountType: "percentage", DiscountValue: 10,
+		StartDate: start, EndDate: end, UsageLimit: 100, IsActive: true})
+	assert.NoError(t, err)
+
+	// and the applicable coupons are looked up by the current time in UTC
+	mockRepo.On("ListCoupons", ctx, mock.MatchedBy(func(f *model.CouponFilter) bool {
+		return f.ValidFrom.Location() == time.UTC
+	})).Return([]*model.Coupon{coupon}, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	applicable, err := service.GetApplicableCoupons(ctx, &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1000}}})
+	assert.NoError(t, err)
+	assert.Len(t, applicable, 1)
+
+	mockRepo.AssertNumberOfCalls(t, "UpdateCoupon", 2)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCouponRules(t *testing.T) {
+	service, mockRepo, _ := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		Code:          "GOLDSHOES",
+		DiscountType:  model.DiscountTypePercentage,
+		DiscountValue: 10,
+		StartDate:     time.Now().Add(-time.Hour),
+		EndDate:       time.Now().Add(time.Hour),
+		UsageLimit:    10,
+		IsActive:      true,
+		Rule:          `cart.items.any(i, i.category == "shoes") && customer.tier in ["gold"] && customer.orders >= 1`,
+	}
+
+	// Rules are checked when the coupon is saved
+	invalid := *coupon
+	invalid.Rule = `customer.tier == 1`
+	err := service.CreateCoupon(ctx, &invalid)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Equal(t, "invalid rule: operator == does not apply to string and int at offset 14", err.Error())
+	mockRepo.AssertNotCalled(t, "CreateCoupon", mock.Anything, mock.Anything)
+
+	// and evaluated with the other rules
+	cart := &model.Cart{
+		CustomerID:   "cust-1",
+		CustomerTier: "gold",
+		Items:        []model.CartItem{{ID: "boot", Price: 8000, CategoryIDs: []string{"shoes"}}},
+		Total:        8000,
+	}
+	usage := &couponUsage{customerOrders: 2}
+	assert.Empty(t, service.checkRules(coupon, cart, time.Now(), usage, nil))
+
+	silver := *cart
+	silver.CustomerTier = "silver"
+	reasons := service.checkRules(coupon, &silver, time.Now(), usage, nil)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, model.ReasonRuleNotMet, reasons[0].Code)
+	assert.Equal(t, "cart does not satisfy the coupon rule "+coupon.Rule, reasons[0].Message)
+
+	firstOrder := &couponUsage{}
+	reasons = service.checkRules(coupon, cart, time.Now(), firstOrder, nil)
+	assert.Equal(t, model.ReasonRuleNotMet, reasons[0].Code)
+
+	// The rule was compiled once and reused for the later evaluations
+	assert.Equal(t, uint64(1), service.rules.Stats().Misses)
+	assert.Equal(t, uint64(2), service.rules.Stats().Hits)
+
+	// A rule that runs out of budget does not apply
+	costly := *coupon
+	costly.Rule = `cart.items.all(a, cart.items.all(b, cart.items.all(c, a.price >= b.price || a.price < c.price)))`
+	large := *cart
+	large.Items = make([]model.CartItem, 40)
+	reasons = service.checkRules(&costly, &large, time.Now(), usage, nil)
+	assert.Equal(t, model.ReasonRuleNotMet, reasons[len(reasons)-1].Code)
+	assert.Equal(t, "coupon rule could not be evaluated: rule exceeded its evaluation budget", reasons[len(reasons)-1].Message)
+}
+
+func TestTimeRulesCacheUntilNextMinute(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		Code:          "HAPPYHOUR",
+		DiscountType:  model.DiscountTypePercentage,
+		DiscountValue: 10,
+		StartDate:     time.Now().Add(-time.Hour),
+		EndDate:       time.Now().Add(24 * time.Hour),
+		UsageLimit:    10,
+		IsActive:      true,
+		Rule:          `now.hour >= 0`,
+	}
+	mockRepo.On("FindCouponByCode", ctx, "HAPPYHOUR").Return(coupon, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+
+	// The result is kept until the minute the rule was evaluated in ends
+	before := time.Now()
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, mock.MatchedBy(func(deadline time.Time) bool {
+		return deadline.After(before) && !deadline.After(time.Now().Truncate(time.Minute).Add(time.Minute))
+	}), mock.Anything).Return().Once()
+
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1000}}, Total: 1000}
+	result, err := service.ValidateCoupon(ctx, "HAPPYHOUR", cart)
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	mockCache.AssertExpectations(t)
+
+	// Rules that do not read the time leave the deadline to the coupon dates
+	now := time.Now()
+	plain := &model.Coupon{Rule: `cart.total > 0`}
+	assert.True(t, service.ruleDeadline(now, plain, &model.Coupon{}).IsZero())
+	assert.Equal(t, now.Truncate(time.Minute).Add(time.Minute), service.ruleDeadline(now, plain, coupon))
+}
+
+func TestCalculateDiscount(t *testing.T) {
+	cart := &model.Cart{
+		Items: []model.CartItem{
+			{ID: "item1", Price: 10000},
+			{ID: "item2", Price: 5000},
+			{ID: "item3", Price: 3000},
+		},
+		Total: 18000,
+	}
+
+	tests := []struct {
+		name      string
+		coupon    *model.Coupon
+		discount  model.Money
+		total     model.Money
+		allocated []model.Money
+	}{
+		{
+			name: "percentage",
+			coupon: &model.Coupon{
+				DiscountType:    model.DiscountTypePercentage,
+				DiscountValue:   10,
+				ApplicableItems: []string{"item1", "item2"},
+			},
+			discount:  1500,
+			total:     16500,
+			allocated: []model.Money{1000, 500, 0},
+		},
+		{
+			name: "percentage capped by max discount",
+			coupon: &model.Coupon{
+				DiscountType:    model.DiscountTypePercentage,
+				DiscountValue:   50,
+				MaxDiscount:     2000,
+				ApplicableItems: []string{"item1", "item2"},
+			},
+			discount:  2000,
+			total:     16000,
+			allocated: []model.Money{1333, 667, 0},
+		},
+		{
+			name: "flat",
+			coupon: &model.Coupon{
+				DiscountType:    model.DiscountTypeFlat,
+				DiscountAmount:  2500,
+				ApplicableItems: []string{"item3"},
+			},
+			discount:  2500,
+			total:     15500,
+			allocated: []model.Money{0, 0, 2500},
+		},
+		{
+			name: "flat limited to applicable items",
+			coupon: &model.Coupon{
+				DiscountType:    model.DiscountTypeFlat,
+				DiscountAmount:  4000,
+				ApplicableItems: []string{"item3"},
+			},
+			discount:  3000,
+			total:     15000,
+			allocated: []model.Money{0, 0, 3000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculateDiscount(tt.coupon, cart, nil, model.RoundHalfUp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.discount, result.Discount)
+			assert.Equal(t, tt.total, result.Total)
+			assert.Len(t, result.Items, len(tt.allocated))
+			for i, allocated := range tt.allocated {
+				assert.Equal(t, allocated, result.Items[i].Discount)
+			}
+		})
+	}
+
+	_, err := calculateDiscount(&model.Coupon{DiscountType: "bogus"}, cart, nil, model.RoundHalfUp)
+	assert.Equal(t, ErrInvalidDiscountType, err)
+
+	// A quarter of 10.10 is 2.525, a half cent the rounding mode decides
+	odd := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1010}}, Total: 1010}
+	quarter := &model.Coupon{DiscountType: model.DiscountTypePercentage, DiscountValue: 25}
+	result, err := calculateDiscount(quarter, odd, nil, model.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(253), result.Discount)
+	result, err = calculateDiscount(quarter, odd, nil, model.RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(252), result.Discount)
+}
+
+func TestMoney(t *testing.T) {
+	assert.Equal(t, "12.50 USD", model.Money(1250).Format("USD"))
+	assert.Equal(t, "-0.05 EUR", model.Money(-5).Format("EUR"))
+	assert.Equal(t, "1250 JPY", model.Money(1250).Format("JPY"))
+	assert.Equal(t, "1.250 KWD", model.Money(1250).Format("KWD"))
+
+	// Halves round up or to the even minor unit, the rest to the nearest one
+	assert.Equal(t, model.Money(3), model.RoundHalfUp.MulDiv(5, 1, 2))
+	assert.Equal(t, model.Money(2), model.RoundHalfEven.MulDiv(5, 1, 2))
+	assert.Equal(t, model.Money(4), model.RoundHalfEven.MulDiv(7, 1, 2))
+	assert.Equal(t, model.Money(2), model.RoundHalfEven.MulDiv(7, 1, 3))
+	assert.Equal(t, model.Money(5), model.RoundHalfUp.MulDiv(14, 1, 3))
+
+	// Intermediate products beyond 64 bits do not overflow
+	assert.Equal(t, model.Money(1<<62), model.RoundHalfUp.MulDiv(1<<62, 1<<40, 1<<40))
+
+	assert.Equal(t, model.Money(150), model.RoundHalfUp.Percent(1000, 15))
+	assert.Equal(t, model.Money(1), model.RoundHalfUp.Percent(10, 12.5))
+
+	mode, err := model.ParseRoundingMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoundHalfUp, mode)
+	mode, err = model.ParseRoundingMode("HALF_EVEN")
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoundHalfEven, mode)
+	_, err = model.ParseRoundingMode("bankers")
+	assert.Error(t, err)
+}
+
+func TestCouponCurrencies(t *testing.T) {
+	coupon := &model.Coupon{
+		DiscountType:   model.DiscountTypeFlat,
+		DiscountAmount: 1000,
+		MinOrderValue:  5000,
+		Currency:       "USD",
+		Prices:         []model.CouponPrice{{Currency: "JPY", DiscountAmount: 1500, MinOrderValue: 7500}},
+		IsActive:       true,
+		StartDate:      time.Now().Add(-time.Hour),
+		EndDate:        time.Now().Add(time.Hour),
+		UsageLimit:     10,
+	}
+
+	// Each currency uses its own amounts
+	usd := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	result, err := calculateDiscount(coupon, usd, nil, model.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", result.Currency)
+	assert.Equal(t, model.Money(1000), result.Discount)
+
+	jpy := &model.Cart{Currency: "JPY", Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	result, err = calculateDiscount(coupon, jpy, nil, model.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, "JPY", result.Currency)
+	assert.Equal(t, model.Money(1500), result.Discount)
+
+	service := NewCouponService(nil, nil)
+	reasons := service.checkRules(coupon, jpy, time.Now(), &couponUsage{}, nil)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, model.ReasonMinOrderValueNotMet, reasons[0].Code)
+	assert.Equal(t, "qualifying total 6000 JPY is below the minimum order value of 7500 JPY", reasons[0].Message)
+
+	// A currency without a price is not offered
+	eur := &model.Cart{Currency: "EUR", Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	_, err = calculateDiscount(coupon, eur, nil, model.RoundHalfUp)
+	assert.Equal(t, ErrCouponNotApplicable, err)
+	reasons = service.checkRules(coupon, eur, time.Now(), &couponUsage{}, nil)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, model.ReasonCurrencyNotOffered, reasons[0].Code)
+
+	// Prices must name distinct valid currencies, with every flat amount set
+	tests := []struct {
+		name   string
+		prices []model.CouponPrice
+		err    error
+	}{
+		{"priced once per currency", []model.CouponPrice{{Currency: "EUR", DiscountAmount: 900}}, nil},
+		{"lowercase currency", []model.CouponPrice{{Currency: "eur", DiscountAmount: 900}}, ErrInvalidPrices},
+		{"coupon currency repeated", []model.CouponPrice{{Currency: "USD", DiscountAmount: 900}}, ErrInvalidPrices},
+		{"missing flat amount", []model.CouponPrice{{Currency: "EUR"}}, ErrInvalidPrices},
+		{"negative minimum", []model.CouponPrice{{Currency: "EUR", DiscountAmount: 900, MinOrderValue: -1}}, ErrInvalidPrices},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priced := *coupon
+			priced.Prices = tt.prices
+			assert.Equal(t, tt.err, checkPrices(&priced))
+		})
+	}
+}
+
+func TestExchangeRateConversion(t *testing.T) {
+	eurUSD := &model.ExchangeRate{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.08}
+	usdJPY := &model.ExchangeRate{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: 151.234}
+	jpyKWD := &model.ExchangeRate{BaseCurrency: "JPY", QuoteCurrency: "KWD", Rate: 0.00203}
+
+	// Rates rescale between the currencies' minor units
+	assert.Equal(t, model.Money(1080), eurUSD.Convert(1000, model.RoundHalfUp))
+	assert.Equal(t, model.Money(1512), usdJPY.Convert(1000, model.RoundHalfUp))
+	assert.Equal(t, model.Money(2030), jpyKWD.Convert(1000, model.RoundHalfUp))
+	assert.True(t, eurUSD.Valid())
+
+	// Results past the largest amount saturate rather than wrap or panic
+	usdVND := &model.ExchangeRate{BaseCurrency: "USD", QuoteCurrency: "VND", Rate: 25000}
+	assert.Equal(t, model.Money(math.MaxInt64), usdVND.Convert(1e18, model.RoundHalfUp))
+	assert.Equal(t, model.Money(math.MaxInt64), eurUSD.Convert(math.MaxInt64-1e16, model.RoundHalfUp))
+	assert.False(t, (&model.ExchangeRate{BaseCurrency: "EUR", QuoteCurrency: "EUR", Rate: 1}).Valid())
+	assert.False(t, (&model.ExchangeRate{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 0}).Valid())
+
+	coupon := &model.Coupon{
+		DiscountType:   model.DiscountTypeFlat,
+		DiscountAmount: 1000,
+		MinOrderValue:  5000,
+		Currency:       "EUR",
+		IsActive:       true,
+		StartDate:      time.Now().Add(-time.Hour),
+		EndDate:        time.Now().Add(time.Hour),
+		UsageLimit:     10,
+	}
+	rates := newExchangeRates([]*model.ExchangeRate{eurUSD, usdJPY})
+
+	// Amounts the coupon is not priced in are converted, and the rate is reported
+	usd := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	result, err := calculateDiscount(coupon, usd, rates, model.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", result.Currency)
+	assert.Equal(t, model.Money(1080), result.Discount)
+	assert.Equal(t, eurUSD, result.Rate)
+
+	service := NewCouponService(nil, nil)
+	small := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 5000}}, Total: 5000}
+	reasons := service.checkRules(coupon, small, time.Now(), &couponUsage{}, rates)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, "qualifying total 50.00 USD is below the minimum order value of 54.00 USD", reasons[0].Message)
+
+	// Prices set on the coupon take precedence over the rates
+	priced := *coupon
+	priced.Prices = []model.CouponPrice{{Currency: "USD", DiscountAmount: 1100, MinOrderValue: 5000}}
+	result, err = calculateDiscount(&priced, usd, rates, model.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(1100), result.Discount)
+	assert.Nil(t, result.Rate)
+
+	// Only rates from the coupon's currency are used
+	jpy := &model.Cart{Currency: "JPY", Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	reasons = service.checkRules(coupon, jpy, time.Now(), &couponUsage{}, rates)
+	assert.Equal(t, model.ReasonCurrencyNotOffered, reasons[0].Code)
+
+	// Tier thresholds and amounts are converted too
+	tiered := &model.Coupon{
+		DiscountType: model.DiscountTypeTiered,
+		Currency:     "EUR",
+		Tiers: []model.DiscountTier{
+			{MinSpend: 5000, DiscountType: model.DiscountTypeFlat, DiscountAmount: 500},
+			{MinSpend: 10000, DiscountType: model.DiscountTypePercentage, DiscountValue: 10, MaxDiscount: 1500},
+		},
+	}
+	converted, rate, offered := pricedFor(tiered, "USD", rates, model.RoundHalfUp)
+	assert.True(t, offered)
+	assert.Equal(t, eurUSD, rate)
+	assert.Equal(t, []model.DiscountTier{
+		{MinSpend: 5400, DiscountType: model.DiscountTypeFlat, DiscountAmount: 540},
+		{MinSpend: 10800, DiscountType: model.DiscountTypePercentage, DiscountValue: 10, MaxDiscount: 1620},
+	}, converted.Tiers)
+	assert.Equal(t, model.Money(5000), tiered.Tiers[0].MinSpend)
+}
+
+func TestExchangeRates(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		ID:             1,
+		Code:           "EURO10",
+		DiscountType:   model.DiscountTypeFlat,
+		DiscountAmount: 1000,
+		Currency:       "EUR",
+		IsActive:       true,
+		StartDate:      time.Now().Add(-time.Hour),
+		EndDate:        time.Now().Add(time.Hour),
+		UsageLimit:     10,
+	}
+	rate := &model.ExchangeRate{ID: 7, BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.08}
+
+	mockRepo.On("FindCouponByCode", ctx, "EURO10").Return(coupon, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockRepo.On("ListExchangeRates", ctx, mock.Anything).Return([]*model.ExchangeRate{rate}, nil).Once()
+	mockCache.On("Get", mock.Anything).Return(nil, false)
+	next := time.Now().Add(30 * time.Minute)
+	mockRepo.On("NextExchangeRateAt", ctx, mock.Anything).Return(next, nil).Once()
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.Anything, next, []string{"coupon:EURO10", "rates"}).Return().Once()
+
+	// A coupon converted into the cart's currency reports the rate it used, and
+	// the cached result is dropped when the rates change or expires when the
+	// next scheduled rate takes effect, before the coupon ends
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 6000}}, Total: 6000}
+	result, err := service.ValidateCoupon(ctx, "EURO10", cart)
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, model.Money(1080), result.Discount.Discount)
+	assert.Equal(t, rate, result.Discount.Rate)
+
+	// Rates need two distinct currencies and a positive rate; the time defaults to now
+	err = service.SetExchangeRates(ctx, []*model.ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "usd", Rate: 1.08}})
+	assert.Equal(t, ErrInvalidExchangeRate, err)
+	err = service.SetExchangeRates(ctx, []*model.ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: -1}})
+	assert.Equal(t, ErrInvalidExchangeRate, err)
+
+	mockRepo.On("SaveExchangeRates", ctx, mock.Anything).Return(nil).Once()
+	mockCache.On("InvalidateTag", "rates").Return().Once()
+	rates := []*model.ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.1}}
+	assert.NoError(t, service.SetExchangeRates(ctx, rates))
+	assert.False(t, rates[0].EffectiveAt.IsZero())
+
+	mockRepo.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestItemEligibility(t *testing.T) {
+	cart := &model.Cart{
+		Items: []model.CartItem{
+			{ID: "shoe", SKU: "shoe-42", Price: 5000, Quantity: 2, CategoryIDs: []string{"shoes", "sport"}, Brand: "acme"},
+			{ID: "shirt", Price: 2000, Quantity: 3, CategoryIDs: []string{"apparel"}, Brand: "globex", OnSale: true},
+			{ID: "sock", Price: 1000, CategoryIDs: []string{"apparel", "sport"}, Brand: "acme"},
+		},
+		Total: 17000,
+	}
+
+	tests := []struct {
+		name      string
+		coupon    *model.Coupon
+		allocated []model.Money
+	}{
+		{
+			name:      "no include rules applies to every line",
+			coupon:    &model.Coupon{},
+			allocated: []model.Money{1000, 600, 100},
+		},
+		{
+			name:      "item by SKU",
+			coupon:    &model.Coupon{ApplicableItems: []string{"shoe-42"}},
+			allocated: []model.Money{1000, 0, 0},
+		},
+		{
+			name:      "included category",
+			coupon:    &model.Coupon{IncludeCategories: []string{"sport"}},
+			allocated: []model.Money{1000, 0, 100},
+		},
+		{
+			name:      "included brand without an excluded category",
+			coupon:    &model.Coupon{IncludeBrands: []string{"acme"}, ExcludeCategories: []string{"shoes"}},
+			allocated: []model.Money{0, 0, 100},
+		},
+		{
+			name:      "excluded brand",
+			coupon:    &model.Coupon{ExcludeBrands: []string{"acme"}},
+			allocated: []model.Money{0, 600, 0},
+		},
+		{
+			name:      "sale items excluded",
+			coupon:    &model.Coupon{IncludeCategories: []string{"apparel"}, ExcludeOnSale: true},
+			allocated: []model.Money{0, 0, 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.coupon.DiscountType = model.DiscountTypePercentage
+			tt.coupon.DiscountValue = 10
+
+			// Quantities multiply the unit price into the line amount the discount is based on
+			result, err := calculateDiscount(tt.coupon, cart, nil, model.RoundHalfUp)
+			assert.NoError(t, err)
+			for i, allocated := range tt.allocated {
+				assert.Equal(t, allocated, result.Items[i].Discount)
+				assert.Equal(t, cart.Items[i].Units(), result.Items[i].Quantity)
+				assert.Equal(t, cart.Items[i].Amount()-allocated, result.Items[i].Total)
+			}
+		})
+	}
+}
+
+func TestPromotions(t *testing.T) {
+	cart := &model.Cart{
+		Items: []model.CartItem{
+			{ID: "shirt", Price: 2000, Quantity: 3, CategoryIDs: []string{"apparel"}},
+			{ID: "sock", SKU: "sock-m", Price: 500, Quantity: 4, CategoryIDs: []string{"apparel"}},
+			{ID: "mug", Price: 1200, CategoryIDs: []string{"home"}},
+		},
+		Total: 9200,
+	}
+
+	tests := []struct {
+		name     string
+		coupon   *model.Coupon
+		discount model.Money
+		rewards  []model.RewardLine
+	}{
+		{
+			name: "buy two get the cheapest free",
+			coupon: &model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, DiscountValue: 100,
+				BuyQuantity: 2, GetQuantity: 1, IncludeCategories: []string{"apparel"}},
+			discount: 1000,
+			rewards:  []model.RewardLine{{ID: "sock", Price: 500, Quantity: 2, Discount: 1000}},
+		},
+		{
+			name: "repeat limit",
+			coupon: &model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, DiscountValue: 100,
+				BuyQuantity: 2, GetQuantity: 1, IncludeCategories: []string{"apparel"}, MaxApplications: 1},
+			discount: 500,
+			rewards:  []model.RewardLine{{ID: "sock", Price: 500, Quantity: 1, Discount: 500}},
+		},
+		{
+			name: "distinct reward items",
+			coupon: &model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, DiscountValue: 50,
+				BuyQuantity: 1, GetQuantity: 1, ApplicableItems: []string{"shirt"}, RewardItems: []string{"mug"}},
+			discount: 600,
+			rewards:  []model.RewardLine{{ID: "mug", Price: 1200, Quantity: 1, Discount: 600}},
+		},
+		{
+			name: "cheapest of every three free",
+			coupon: &model.Coupon{DiscountType: model.DiscountTypeCheapestFree, DiscountValue: 100,
+				BuyQuantity: 3, GetQuantity: 1},
+			discount: 2500,
+			rewards: []model.RewardLine{
+				{ID: "shirt", Price: 2000, Quantity: 1, Discount: 2000},
+				{ID: "sock", Price: 500, Quantity: 1, Discount: 500},
+			},
+		},
+		{
+			name: "not enough qualifying units",
+			coupon: &model.Coupon{DiscountType: model.DiscountTypeCheapestFree, DiscountValue: 100,
+				BuyQuantity: 3, GetQuantity: 1, ApplicableItems: []string{"mug"}},
+			discount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculateDiscount(tt.coupon, cart, nil, model.RoundHalfUp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.discount, result.Discount)
+			assert.Equal(t, cart.Total-tt.discount, result.Total)
+			assert.Equal(t, tt.rewards, result.Rewards)
+
+			// The reward lines carry the whole discount of their cart lines
+			for _, reward := range tt.rewards {
+				for _, item := range result.Items {
+					if item.ID == reward.ID {
+						assert.Equal(t, reward.Discount, item.Discount)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("large quantities", func(t *testing.T) {
+		bulk := &model.Cart{Items: []model.CartItem{
+			{ID: "pen", Price: 101, Quantity: maxQuantity},
+			{ID: "pad", Price: 300, Quantity: maxQuantity},
+		}}
+		bulk.Total = bulk.Subtotal()
+
+		// One pen free for every two bought
+		coupon := &model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, DiscountValue: 100,
+			BuyQuantity: 2, GetQuantity: 1, ApplicableItems: []string{"pen"}}
+		result, err := calculateDiscount(coupon, bulk, nil, model.RoundHalfUp)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.RewardLine{{ID: "pen", Price: 101, Quantity: 33333, Discount: 33333 * 101}}, result.Rewards)
+
+		// Pads come first, and two of every three units are free
+		coupon = &model.Coupon{DiscountType: model.DiscountTypeCheapestFree, DiscountValue: 100,
+			BuyQuantity: 3, GetQuantity: 2}
+		result, err = calculateDiscount(coupon, bulk, nil, model.RoundHalfUp)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.RewardLine{
+			{ID: "pen", Price: 101, Quantity: 66666, Discount: 66666 * 101},
+			{ID: "pad", Price: 300, Quantity: 66666, Discount: 66666 * 300},
+		}, result.Rewards)
+	})
+
+	t.Run("reason when the promotion is not met", func(t *testing.T) {
+		coupon := &model.Coupon{DiscountType: model.DiscountTypeCheapestFree, DiscountValue: 100,
+			BuyQuantity: 3, GetQuantity: 1, ApplicableItems: []string{"mug"}, IsActive: true,
+			StartDate: time.Now().Add(-time.Hour), EndDate: time.Now().Add(time.Hour), UsageLimit: 10}
+
+		reasons := NewCouponService(nil, nil).checkRules(coupon, cart, time.Now(), &couponUsage{}, nil)
+		assert.Len(t, reasons, 1)
+		assert.Equal(t, model.ReasonPromotionNotMet, reasons[0].Code)
+	})
+}
+
+func TestCheckPromotionFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon model.Coupon
+		err    error
+	}{
+		{"buy x get y", model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, BuyQuantity: 1, GetQuantity: 1}, nil},
+		{"buy x get y without buy quantity", model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, GetQuantity: 1}, ErrInvalidBuyQuantity},
+		{"buy x get y without get quantity", model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, BuyQuantity: 1}, ErrInvalidGetQuantity},
+		{"cheapest free", model.Coupon{DiscountType: model.DiscountTypeCheapestFree, BuyQuantity: 3, GetQuantity: 1}, nil},
+		{"cheapest free of one unit", model.Coupon{DiscountType: model.DiscountTypeCheapestFree, BuyQuantity: 1, GetQuantity: 1}, ErrInvalidBuyQuantity},
+		{"cheapest free of the whole group", model.Coupon{DiscountType: model.DiscountTypeCheapestFree, BuyQuantity: 2, GetQuantity: 2}, ErrInvalidGetQuantity},
+		{"negative repeat limit", model.Coupon{DiscountType: model.DiscountTypeBuyXGetY, BuyQuantity: 1, GetQuantity: 1, MaxApplications: -1}, ErrInvalidMaxApplications},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, checkPromotionFields(&tt.coupon))
+		})
+	}
+}
+
+func TestTieredDiscount(t *testing.T) {
+	coupon := &model.Coupon{
+		DiscountType: model.DiscountTypeTiered,
+		Tiers: []model.DiscountTier{
+			{MinSpend: 5000, DiscountType: model.DiscountTypeFlat, DiscountAmount: 500},
+			{MinSpend: 10000, DiscountType: model.DiscountTypeFlat, DiscountAmount: 1500},
+			{MinSpend: 20000, DiscountType: model.DiscountTypePercentage, DiscountValue: 25, MaxDiscount: 4000},
+		},
+		ExcludeBrands: []string{"globex"},
+	}
+
+	tests := []struct {
+		name      string
+		spend     model.Money
+		discount  model.Money
+		level     int
+		remaining model.Money
+	}{
+		{"below the first tier", 3000, 0, 0, 2000},
+		{"first tier", 5000, 500, 1, 5000},
+		{"second tier", 12000, 1500, 2, 8000},
+		{"top tier is capped", 25000, 4000, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Ineligible lines do not count towards the spend
+			cart := &model.Cart{
+				Items: []model.CartItem{
+					{ID: "eligible", Price: tt.spend},
+					{ID: "excluded", Price: 10000, Brand: "globex"},
+				},
+				Total: tt.spend + 10000,
+			}
+
+			result, err := calculateDiscount(coupon, cart, nil, model.RoundHalfUp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.discount, result.Discount)
+			assert.Equal(t, tt.discount, result.Items[0].Discount)
+			assert.Equal(t, model.Money(0), result.Items[1].Discount)
+
+			assert.NotNil(t, result.Tier)
+			assert.Equal(t, tt.spend, result.Tier.Spend)
+			assert.Equal(t, tt.level, result.Tier.Level)
+			assert.Equal(t, tt.remaining, result.Tier.Remaining)
+			if tt.level > 0 {
+				assert.Equal(t, coupon.Tiers[tt.level-1], *result.Tier.Reached)
+			} else {
+				assert.Nil(t, result.Tier.Reached)
+			}
+			if tt.level < len(coupon.Tiers) {
+				assert.Equal(t, coupon.Tiers[tt.level], *result.Tier.Next)
+			} else {
+				assert.Nil(t, result.Tier.Next)
+			}
+		})
+	}
+
+	t.Run("reason below the first tier", func(t *testing.T) {
+		coupon := *coupon
+		coupon.IsActive = true
+		coupon.StartDate = time.Now().Add(-time.Hour)
+		coupon.EndDate = time.Now().Add(time.Hour)
+		coupon.UsageLimit = 10
+
+		cart := &model.Cart{Items: []model.CartItem{{ID: "eligible", Price: 3000}}, Total: 3000}
+		reasons := NewCouponService(nil, nil).checkRules(&coupon, cart, time.Now(), &couponUsage{}, nil)
+		assert.Len(t, reasons, 1)
+		assert.Equal(t, model.ReasonTierNotReached, reasons[0].Code)
+		assert.Contains(t, reasons[0].Message, "20.00 USD")
+	})
+}
+
+func TestCheckTiers(t *testing.T) {
+	flat := func(minSpend, amount model.Money) model.DiscountTier {
+		return model.DiscountTier{MinSpend: minSpend, DiscountType: model.DiscountTypeFlat, DiscountAmount: amount}
+	}
+
+	tests := []struct {
+		name  string
+		tiers []model.DiscountTier
+		err   error
+	}{
+		{"ascending tiers", []model.DiscountTier{flat(5000, 500), flat(10000, 1500)}, nil},
+		{"no tiers", nil, ErrInvalidTiers},
+		{"tiers out of order", []model.DiscountTier{flat(10000, 1500), flat(5000, 500)}, ErrInvalidTiers},
+		{"repeated threshold", []model.DiscountTier{flat(5000, 500), flat(5000, 1000)}, ErrInvalidTiers},
+		{"negative threshold", []model.DiscountTier{flat(-1, 500)}, ErrInvalidTiers},
+		{"missing discount", []model.DiscountTier{flat(5000, 0)}, ErrInvalidTiers},
+		{"unknown discount type", []model.DiscountTier{{MinSpend: 5000, DiscountType: "tiered", DiscountValue: 5}}, ErrInvalidTiers},
+		{"percentage above 100", []model.DiscountTier{{MinSpend: 5000, DiscountType: model.DiscountTypePercentage, DiscountValue: 120}}, ErrInvalidTiers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, checkTiers(tt.tiers))
+		})
+	}
+}
+
+func TestShippingDiscount(t *testing.T) {
+	cart := &model.Cart{
+		Items:          []model.CartItem{{ID: "item1", Price: 4000}},
+		ShippingMethod: "standard",
+		Shipping:       1200,
+		Total:          5200,
+	}
+
+	tests := []struct {
+		name     string
+		coupon   *model.Coupon
+		shipping model.Money
+	}{
+		{"free shipping", &model.Coupon{DiscountType: model.DiscountTypeFreeShipping}, 1200},
+		{"percentage off shipping", &model.Coupon{DiscountType: model.DiscountTypeShippingPercentage, DiscountValue: 50}, 600},
+		{"capped percentage off shipping", &model.Coupon{DiscountType: model.DiscountTypeShippingPercentage, DiscountValue: 50, MaxDiscount: 400}, 400},
+		{"flat off shipping", &model.Coupon{DiscountType: model.DiscountTypeShippingFlat, DiscountAmount: 500}, 500},
+		{"flat above the shipping cost", &model.Coupon{DiscountType: model.DiscountTypeShippingFlat, DiscountAmount: 2000}, 1200},
+		{"eligible method", &model.Coupon{DiscountType: model.DiscountTypeFreeShipping, ShippingMethods: []string{"standard"}}, 1200},
+		{"other method", &model.Coupon{DiscountType: model.DiscountTypeFreeShipping, ShippingMethods: []string{"express"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculateDiscount(tt.coupon, cart, nil, model.RoundHalfUp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.shipping, result.ShippingDiscount)
+			assert.Equal(t, model.Money(0), result.MerchandiseDiscount)
+			assert.Equal(t, tt.shipping, result.Discount)
+			assert.Equal(t, cart.Total-tt.shipping, result.Total)
+			assert.Equal(t, model.Money(0), result.Items[0].Discount)
+		})
+	}
+
+	t.Run("stacked with a merchandise discount", func(t *testing.T) {
+		coupons := []*model.Coupon{
+			{Code: "SHIP", DiscountType: model.DiscountTypeShippingFlat, DiscountAmount: 800},
+			{Code: "FREESHIP", DiscountType: model.DiscountTypeFreeShipping},
+			{Code: "P10", DiscountType: model.DiscountTypePercentage, DiscountValue: 10},
+		}
+
+		// The second shipping coupon only takes off what the first one left
+		combination, err := applyCombination(coupons, cart, nil, model.RoundHalfUp)
+		assert.NoError(t, err)
+		assert.Equal(t, model.Money(800), combination.Coupons[0].Discount.ShippingDiscount)
+		assert.Equal(t, model.Money(400), combination.Coupons[1].Discount.ShippingDiscount)
+		assert.Equal(t, model.Money(1200), combination.Discount.ShippingDiscount)
+		assert.Equal(t, model.Money(400), combination.Discount.MerchandiseDiscount)
+		assert.Equal(t, model.Money(1600), combination.Discount.Discount)
+		assert.Equal(t, model.Money(3600), combination.Discount.Total)
+	})
+
+	t.Run("reasons", func(t *testing.T) {
+		coupon := &model.Coupon{DiscountType: model.DiscountTypeFreeShipping, ShippingMethods: []string{"express"},
+			IsActive: true, StartDate: time.Now().Add(-time.Hour), EndDate: time.Now().Add(time.Hour), UsageLimit: 10}
+		service := NewCouponService(nil, nil)
+
+		reasons := service.checkRules(coupon, cart, time.Now(), &couponUsage{}, nil)
+		assert.Len(t, reasons, 1)
+		assert.Equal(t, model.ReasonShippingNotEligible, reasons[0].Code)
+
+		noShipping := &model.Cart{Items: cart.Items, ShippingMethod: "express", Total: 4000}
+		reasons = service.checkRules(coupon, noShipping, time.Now(), &couponUsage{}, nil)
+		assert.Len(t, reasons, 1)
+		assert.Equal(t, model.ReasonNoShippingCharge, reasons[0].Code)
+	})
+}
+
+func TestCheckCart(t *testing.T) {
+	items := []model.CartItem{{ID: "item1", Price: 1000, Quantity: 3}, {ID: "item2", Price: 450}}
+
+	tests := []struct {
+		name     string
+		cart     model.Cart
+		err      error
+		total    model.Money
+		currency string
+	}{
+		{"matching total", model.Cart{Items: items, Shipping: 500, Tax: 250, Fees: 100, Total: 4300}, nil, 4300, "USD"},
+		{"omitted total", model.Cart{Items: items, Shipping: 500}, nil, 3950, "USD"},
+		{"other currency", model.Cart{Currency: "EUR", Items: items}, nil, 3450, "EUR"},
+		{"inflated total", model.Cart{Items: items, Total: 1000000}, ErrCartTotalMismatch, 0, "USD"},
+		{"charges left out of the total", model.Cart{Items: items, Shipping: 500, Total: 3450}, ErrCartTotalMismatch, 0, "USD"},
+		{"negative price", model.Cart{Items: []model.CartItem{{ID: "item1", Price: -1}}}, ErrInvalidCart, 0, "USD"},
+		{"negative quantity", model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1, Quantity: -2}}}, ErrInvalidCart, 0, "USD"},
+		{"absurd quantity", model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1, Quantity: maxQuantity + 1}}}, ErrInvalidCart, 0, "USD"},
+		{"negative charge", model.Cart{Items: items, Fees: -1}, ErrInvalidCart, 0, "USD"},
+		{"invalid currency", model.Cart{Currency: "usd", Items: items}, ErrInvalidCurrency, 0, "usd"},
+		{"overflowing line", model.Cart{Items: []model.CartItem{{ID: "item1", Price: 5e18, Quantity: 3}}}, ErrCartOverflow, 0, "USD"},
+		{"overflowing subtotal", model.Cart{Items: []model.CartItem{{ID: "item1", Price: 5e18}, {ID: "item2", Price: 5e18}}}, ErrCartOverflow, 0, "USD"},
+		{"overflowing charges", model.Cart{Items: items, Shipping: math.MaxInt64}, ErrCartOverflow, 0, "USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := tt.cart
+			checked, err := checkCart(&cart)
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, tt.total, checked.Total)
+				assert.Equal(t, tt.currency, checked.Currency)
+			}
+
+			// The cart itself is left as it was
+			assert.Equal(t, tt.cart, cart)
+		})
+	}
+}
+
+func TestQualifyingTotal(t *testing.T) {
+	mockRepo := new(MockRepository)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		ID:             1,
+		Code:           "MIN50",
+		DiscountType:   "flat",
+		DiscountAmount: 500,
+		MinOrderValue:  5000,
+		StartDate:      time.Now().Add(-time.Hour),
+		EndDate:        time.Now().Add(24 * time.Hour),
+		UsageLimit:     100,
+		IsActive:       true,
+	}
+	mockRepo.On("FindCouponByCode", ctx, "MIN50").Return(coupon, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+
+	// 45 of items and 10 of shipping only qualify when shipping counts
+	cart := func() *model.Cart {
+		return &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 1500, Quantity: 3}}, Shipping: 1000, Total: 5500}
+	}
+
+	service := NewCouponService(mockRepo, cache.NewLRU(10))
+	result, err := service.ValidateCoupon(ctx, "MIN50", cart())
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, model.ReasonMinOrderValueNotMet, result.Reasons[0].Code)
+	assert.Equal(t, "qualifying total 45.00 USD is below the minimum order value of 50.00 USD", result.Reasons[0].Message)
+
+	service = NewCouponServiceWithConfig(mockRepo, cache.NewLRU(10), Config{QualifyShipping: true})
+	result, err = service.ValidateCoupon(ctx, "MIN50", cart())
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, model.Money(5000), result.Discount.Total)
+
+	// A total that does not add up is rejected before any coupon is checked
+	inflated := cart()
+	inflated.Total = 1000000
+	_, err = service.ValidateCoupon(ctx, "MIN50", inflated)
+	assert.ErrorIs(t, err, ErrCartTotalMismatch)
+}
+
+func TestPatchCoupon(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{
+		ID:              1,
+		Code:            "TEST10",
+		DiscountType:    "percentage",
+		DiscountValue:   10,
+		StartDate:       time.Now(),
+		EndDate:         time.Now().Add(24 * time.Hour),
+		UsageLimit:      100,
+		UsageCount:      3,
+		IsActive:        true,
+		ApplicableItems: []string{"item1"},
+	}
+
+	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil)
+	mockRepo.On("FindCouponByCode", ctx, "MISSING").Return(nil, nil)
+	mockRepo.On("UpdateCoupon", ctx, coupon).Return(nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	value := 15.0
+	updated, err := service.PatchCoupon(ctx, "TEST10", &model.CouponPatch{DiscountValue: &value})
+	assert.NoError(t, err)
+	assert.Equal(t, 15.0, updated.DiscountValue)
+	assert.Equal(t, 3, updated.UsageCount)
+	assert.True(t, updated.IsActive)
+
+	// Patched coupons are validated like new ones
+	currency := "usd"
+	_, err = service.PatchCoupon(ctx, "TEST10", &model.CouponPatch{Currency: &currency})
+	assert.Equal(t, ErrInvalidCurrency, err)
+
+	value = 150
+	_, err = service.PatchCoupon(ctx, "TEST10", &model.CouponPatch{DiscountValue: &value})
+	assert.Equal(t, ErrInvalidDiscountValue, err)
+
+	_, err = service.PatchCoupon(ctx, "MISSING", &model.CouponPatch{})
+	assert.Equal(t, ErrCouponNotFound, err)
+
+	mockRepo.AssertNumberOfCalls(t, "UpdateCoupon", 1)
+	mockCache.AssertCalled(t, "InvalidateTag", "coupon:TEST10")
+	mockCache.AssertCalled(t, "InvalidateTag", "catalog")
+}
+
+func TestGenerateCacheKey(t *testing.T) {
+	cart := &model.Cart{CustomerID: "cust-1", Items: []model.CartItem{{ID: "item1", Price: 15000}}, Total: 15000}
+	same := &model.Cart{CustomerID: "cust-1", Items: []model.CartItem{{ID: "item1", Price: 15000}}, Total: 15000}
+	other := &model.Cart{CustomerID: "cust-1", Items: []model.CartItem{{ID: "item1", Price: 20000}}, Total: 20000}
+
+	key, ok := generateCacheKey("validate", "TEST10", cart)
+	assert.True(t, ok)
+
+	sameKey, _ := generateCacheKey("validate", "TEST10", same)
+	otherCart, _ := generateCacheKey("validate", "TEST10", other)
+	otherCode, _ := generateCacheKey("validate", "TEST20", cart)
+	otherPrefix, _ := generateCacheKey("applicable", "TEST10", cart)
+
+	assert.Equal(t, key, sameKey)
+	assert.NotEqual(t, key, otherCart)
+	assert.NotEqual(t, key, otherCode)
+	assert.NotEqual(t, key, otherPrefix)
+}
+
+func TestCachedValidation(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewCouponService(mockRepo, cache.NewLRU(10))
+	ctx := context.Background()
+
+	newCoupon := func(id uint, code string) *model.Coupon {
+		return &model.Coupon{
+			ID:              id,
+			Code:            code,
+			DiscountType:    "percentage",
+			DiscountValue:   10,
+			StartDate:       time.Now().Add(-time.Hour),
+			EndDate:         time.Now().Add(24 * time.Hour),
+			UsageLimit:      100,
+			IsActive:        true,
+			ApplicableItems: []string{"item1"},
+		}
+	}
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 15000}}, Total: 15000}
+	bigCart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 20000}}, Total: 20000}
+
+	mockRepo.On("FindCouponByCode", ctx, "A").Return(newCoupon(1, "A"), nil)
+	mockRepo.On("FindCouponByCode", ctx, "B").Return(newCoupon(2, "B"), nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+	mockRepo.On("FindRedemptionByOrderID", ctx, "order-1").Return(nil, nil)
+	mockRepo.On("RedeemCoupon", ctx, mock.Anything).Return(&model.Redemption{CouponID: 1, CouponCode: "A", OrderID: "order-1"}, nil)
+
+	validate := func(code string, cart *model.Cart) model.Money {
+		result, err := service.ValidateCoupon(ctx, code, cart)
+		assert.NoError(t, err)
+		assert.True(t, result.Valid)
+		return result.Discount.Discount
+	}
+
+	// Each code and cart gets its own entry
+	assert.Equal(t, model.Money(1500), validate("A", cart))
+	assert.Equal(t, model.Money(1500), validate("A", cart))
+	assert.Equal(t, model.Money(2000), validate("A", bigCart))
+	assert.Equal(t, model.Money(1500), validate("B", cart))
+	mockRepo.AssertNumberOfCalls(t, "FindCouponByCode", 3)
+
+	// Redeeming A drops only the results for A
+	_, err := service.RedeemCoupon(ctx, "A", "order-1", cart)
+	assert.NoError(t, err)
+	mockRepo.AssertNumberOfCalls(t, "FindCouponByCode", 4)
+
+	validate("B", cart)
+	mockRepo.AssertNumberOfCalls(t, "FindCouponByCode", 4)
+	validate("A", cart)
+	validate("A", bigCart)
+	mockRepo.AssertNumberOfCalls(t, "FindCouponByCode", 6)
+}
+
+func TestCachedResultsExpireWithCoupons(t *testing.T) {
+	mockRepo := new(MockRepository)
+	// Entries never expire on their own
+	service := NewCouponService(mockRepo, cache.NewLRU(10))
+	ctx := context.Background()
+
+	now := time.Now()
+	ending := &model.Coupon{ID: 1, Code: "ENDING", DiscountType: "percentage", DiscountValue: 10,
+		StartDate: now.Add(-time.Hour), EndDate: now.Add(50 * time.Millisecond), UsageLimit: 100, IsActive: true}
+	starting := &model.Coupon{ID: 2, Code: "STARTING", DiscountType: "percentage", DiscountValue: 20,
+		StartDate: now.Add(50 * time.Millisecond), EndDate: now.Add(time.Hour), UsageLimit: 100, IsActive: true}
+	cart := &model.Cart{Items: []model.CartItem{{ID: "item1", Price: 15000}}}
+
+	mockRepo.On("FindCouponByCode", ctx, "ENDING").Return(ending, nil)
+	mockRepo.On("ListCoupons", ctx, mock.Anything).Return([]*model.Coupon{starting}, nil)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil)
+
+	result, err := service.ValidateCoupon(ctx, "ENDING", cart)
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	applicable, err := service.GetApplicableCoupons(ctx, cart)
+	assert.NoError(t, err)
+	assert.Empty(t, applicable)
+
+	// The results are cached until the first coupon ends and the other starts
+	_, err = service.ValidateCoupon(ctx, "ENDING", cart)
+	assert.NoError(t, err)
+	_, err = service.GetApplicableCoupons(ctx, cart)
+	assert.NoError(t, err)
+	mockRepo.AssertNumberOfCalls(t, "FindCouponByCode", 1)
+	mockRepo.AssertNumberOfCalls(t, "ListCoupons", 1)
+
+	time.Sleep(100 * time.Millisecond)
+
+	result, err = service.ValidateCoupon(ctx, "ENDING", cart)
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, model.ReasonCouponExpired, result.Reasons[0].Code)
+
+	applicable, err = service.GetApplicableCoupons(ctx, cart)
+	assert.NoError(t, err)
+	if assert.Len(t, applicable, 1) {
+		assert.Equal(t, "STARTING", applicable[0].Code)
+	}
+}
+
+func TestCachedResultsSerialize(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisCache, err := cache.NewRedis(context.Background(), cache.RedisConfig{URL: "redis://" + server.Addr()})
+	assert.NoError(t, err)
+	defer redisCache.Close()
+
+	discount := &model.DiscountResult{Currency: "USD", Subtotal: 15000, Discount: 1500, Total: 13500, Items: []model.ItemDiscount{{ID: "item1", Price: 15000, Discount: 1500, Total: 13500}}}
+	applicable := []*model.ApplicableCoupon{{
+		Coupon:   &model.Coupon{ID: 1, Code: "TEST10", DiscountType: "percentage", DiscountValue: 10, ApplicableItems: []string{"item1"}},
+		Discount: discount,
+	}}
+	validation := &model.ValidationResult{Valid: true, Discount: discount}
+
+	redisCache.SetWithTags("applicable", applicable, catalogTag)
+	redisCache.SetWithTags("validate", validation, couponTag("TEST10"))
+
+	cached, ok := redisCache.Get("applicable")
+	assert.True(t, ok)
+	assert.Equal(t, applicable, cached)
+
+	cached, ok = redisCache.Get("validate")
+	assert.True(t, ok)
+	assert.Equal(t, validation, cached)
+}
+
+func TestListCouponsPage(t *testing.T) {
+	service, mockRepo, _ := setupTestService(t)
+	ctx := context.Background()
+
+	page := &model.CouponPage{Coupons: []*model.Coupon{{Code: "TEST10"}}, NextCursor: "next"}
+	mockRepo.On("ListCouponsPage", ctx, &model.CouponQuery{Sort: model.CouponSortCreatedAt, Limit: DefaultPageSize}).Return(page, nil)
+
+	result, err := service.ListCouponsPage(ctx, &model.CouponQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, "next", result.NextCursor)
+
+	_, err = service.ListCouponsPage(ctx, &model.CouponQuery{Sort: "usage_count"})
+	assert.Equal(t, ErrInvalidSortField, err)
+
+	_, err = service.ListCouponsPage(ctx, &model.CouponQuery{Limit: MaxPageSize + 1})
+	assert.Equal(t, ErrInvalidPageSize, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDeleteCoupon(t *testing.T) {
+	service, mockRepo, mockCache := setupTestService(t)
+	ctx := context.Background()
+
+	coupon := &model.Coupon{ID: 1, Code: "TEST10"}
+
+	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil)
+	mockRepo.On("DeleteCoupon", ctx, coupon).Return(nil)
+	mockCache.On("InvalidateTag", mock.Anything).Return()
+
+	err := service.DeleteCoupon(ctx, "TEST10")
 	assert.NoError(t, err)
 
 	mockRepo.AssertExpectations(t)
@@ -189,8 +2006,8 @@ func TestConcurrentOperations(t *testing.T) {
 		Code:            "TEST10",
 		DiscountType:    "percentage",
 		DiscountValue:   10,
-		MinOrderValue:   100,
-		MaxDiscount:     50,
+		MinOrderValue:   10000,
+		MaxDiscount:     5000,
 		StartDate:       time.Now(),
 		EndDate:         time.Now().Add(24 * time.Hour),
 		UsageLimit:      100,
@@ -201,25 +2018,25 @@ func TestConcurrentOperations(t *testing.T) {
 
 	// Setup expectations
 	mockRepo.On("FindCouponByCode", ctx, "TEST10").Return(coupon, nil).Times(10)
-	mockRepo.On("UpdateCoupon", ctx, mock.AnythingOfType("*model.Coupon")).Return(nil).Times(10)
+	mockRepo.On("CountActiveReservations", ctx, mock.Anything, mock.Anything).Return(map[uint]int{}, nil).Times(10)
 	mockCache.On("Get", mock.Anything).Return(nil, false).Times(10)
-	mockCache.On("Set", mock.Anything, true).Return().Times(10)
+	mockCache.On("SetWithTagsUntil", mock.Anything, mock.AnythingOfType("*model.ValidationResult"), mock.Anything, mock.Anything).Return().Times(10)
 
 	// Test data
 	cart := &model.Cart{
 		Items: []model.CartItem{
-			{ID: "item1", Price: 150},
+			{ID: "item1", Price: 15000},
 		},
-		Total: 150,
+		Total: 15000,
 	}
 
 	// Test concurrent operations
 	done := make(chan bool)
 	for i := 0; i < 10; i++ {
 		go func() {
-			valid, err := service.ValidateCoupon(ctx, "TEST10", cart)
+			result, err := service.ValidateCoupon(ctx, "TEST10", cart)
 			assert.NoError(t, err)
-			assert.True(t, valid)
+			assert.True(t, result.Valid)
 			done <- true
 		}()
 	}
@@ -0,0 +1,130 @@
+package service
+
+import "github.com/Sensrdt/coupon-system/internal/model"
+
+// cartCurrency returns the cart's currency, or the default one when it names none
+func cartCurrency(cart *model.Cart) string {
+	if cart.Currency == "" {
+		return model.DefaultCurrency
+	}
+	return cart.Currency
+}
+
+// couponCurrency returns the coupon's currency, or the default one when it names none
+func couponCurrency(coupon *model.Coupon) string {
+	if coupon.Currency == "" {
+		return model.DefaultCurrency
+	}
+	return coupon.Currency
+}
+
+// exchangeRates holds the rates in effect, keyed by currency pair. A nil set has
+// no rates.
+type exchangeRates map[string]*model.ExchangeRate
+
+// newExchangeRates indexes the rates by currency pair
+func newExchangeRates(rates []*model.ExchangeRate) exchangeRates {
+	set := make(exchangeRates, len(rates))
+	for _, rate := range rates {
+		set[rate.BaseCurrency+"/"+rate.QuoteCurrency] = rate
+	}
+	return set
+}
+
+// find returns the rate converting from base into quote, or nil if there is none
+func (r exchangeRates) find(base, quote string) *model.ExchangeRate {
+	return r[base+"/"+quote]
+}
+
+// pricedFor returns the coupon with its amounts in the currency, and whether the
+// coupon is offered in it at all. An empty currency is the default one. Prices
+// set on the coupon take precedence; otherwise its amounts are converted at the
+// rate from its currency, which is returned along with the converted coupon.
+func pricedFor(coupon *model.Coupon, currency string, rates exchangeRates, rounding model.RoundingMode) (*model.Coupon, *model.ExchangeRate, bool) {
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+
+	if couponCurrency(coupon) == currency {
+		return coupon, nil, true
+	}
+
+	for _, price := range coupon.Prices {
+		if price.Currency != currency {
+			continue
+		}
+
+		priced := *coupon
+		priced.Currency = currency
+		priced.DiscountAmount = price.DiscountAmount
+		priced.MinOrderValue = price.MinOrderValue
+		priced.MaxDiscount = price.MaxDiscount
+		priced.Tiers = price.Tiers
+		return &priced, nil, true
+	}
+
+	rate := rates.find(couponCurrency(coupon), currency)
+	if rate == nil {
+		return nil, nil, false
+	}
+
+	priced := *coupon
+	priced.Currency = currency
+	priced.DiscountAmount = rate.Convert(coupon.DiscountAmount, rounding)
+	priced.MinOrderValue = rate.Convert(coupon.MinOrderValue, rounding)
+	priced.MaxDiscount = rate.Convert(coupon.MaxDiscount, rounding)
+	priced.Tiers = make([]model.DiscountTier, len(coupon.Tiers))
+	for i, tier := range coupon.Tiers {
+		tier.MinSpend = rate.Convert(tier.MinSpend, rounding)
+		tier.DiscountAmount = rate.Convert(tier.DiscountAmount, rounding)
+		tier.MaxDiscount = rate.Convert(tier.MaxDiscount, rounding)
+		priced.Tiers[i] = tier
+	}
+	return &priced, rate, true
+}
+
+// needsRates reports whether any of the coupons has to be converted into the
+// currency because it is not priced in it
+func needsRates(coupons []*model.Coupon, currency string) bool {
+	for _, coupon := range coupons {
+		if _, _, offered := pricedFor(coupon, currency, nil, ""); !offered {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrices validates the coupon's currency and its prices in other currencies.
+// Each currency is priced once, and a tiered coupon's prices hold their own tiers.
+func checkPrices(coupon *model.Coupon) error {
+	currency := couponCurrency(coupon)
+	if !model.ValidCurrency(currency) {
+		return ErrInvalidCurrency
+	}
+
+	seen := map[string]bool{currency: true}
+	for _, price := range coupon.Prices {
+		if !model.ValidCurrency(price.Currency) || seen[price.Currency] {
+			return ErrInvalidPrices
+		}
+		seen[price.Currency] = true
+
+		if !validAmount(price.DiscountAmount) || !validAmount(price.MinOrderValue) || !validAmount(price.MaxDiscount) {
+			return ErrInvalidPrices
+		}
+
+		// Flat discounts need their amount in every currency
+		if (coupon.DiscountType == model.DiscountTypeFlat || coupon.DiscountType == model.DiscountTypeShippingFlat) &&
+			price.DiscountAmount <= 0 {
+			return ErrInvalidPrices
+		}
+
+		if coupon.DiscountType == model.DiscountTypeTiered {
+			if err := checkTiers(price.Tiers); err != nil {
+				return ErrInvalidPrices
+			}
+		}
+	}
+
+	return nil
+}
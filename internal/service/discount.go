@@ -0,0 +1,141 @@
+package service
+
+import (
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// calculateDiscount computes the discount a coupon gives the cart. Percentage and
+// flat discounts are allocated across the applicable lines in proportion to their
+// amount, promotions discount the reward units of their lines and shipping
+// discounts come off the shipping.
+func calculateDiscount(coupon *model.Coupon, cart *model.Cart, rates exchangeRates, rounding model.RoundingMode) (*model.DiscountResult, error) {
+	return discountLines(coupon, cart, lineAmounts(cart), cart.Shipping, cart.Total, rates, rounding)
+}
+
+// discountLines computes the coupon's discount on what is left of the cart after
+// earlier discounts: amounts holds what is left of each line, shipping what is
+// left of the shipping and total what is left of the cart total. Amounts are in
+// the cart's currency, a coupon not priced in it is converted at the rates, and
+// fractions of a minor unit are rounded in the given mode.
+func discountLines(coupon *model.Coupon, cart *model.Cart, amounts []model.Money, shipping, total model.Money, rates exchangeRates, rounding model.RoundingMode) (*model.DiscountResult, error) {
+	coupon, rate, ok := pricedFor(coupon, cart.Currency, rates, rounding)
+	if !ok {
+		return nil, ErrCouponNotApplicable
+	}
+
+	var shares []model.Money
+	var rewards []model.RewardLine
+	var progress *model.TierProgress
+	var shippingDiscount model.Money
+	switch coupon.DiscountType {
+	case model.DiscountTypePercentage, model.DiscountTypeFlat:
+		base := eligibleBase(coupon, cart, amounts)
+		off := amountOff(coupon.DiscountType, coupon.DiscountValue, coupon.DiscountAmount, coupon.MaxDiscount, base, rounding)
+		shares = proportionalLines(coupon, cart, amounts, base, min(off, total), rounding)
+	case model.DiscountTypeTiered:
+		base := eligibleBase(coupon, cart, amounts)
+		progress = tierProgress(coupon.Tiers, base)
+		shares = make([]model.Money, len(cart.Items))
+		if tier := progress.Reached; tier != nil {
+			off := amountOff(tier.DiscountType, tier.DiscountValue, tier.DiscountAmount, tier.MaxDiscount, base, rounding)
+			shares = proportionalLines(coupon, cart, amounts, base, min(off, total), rounding)
+		}
+	case model.DiscountTypeBuyXGetY, model.DiscountTypeCheapestFree:
+		shares, rewards = promotionLines(coupon, cart, amounts, rounding)
+	case model.DiscountTypeFreeShipping, model.DiscountTypeShippingPercentage, model.DiscountTypeShippingFlat:
+		shares = make([]model.Money, len(cart.Items))
+		shippingDiscount = min(shippingOff(coupon, cart, shipping, rounding), total)
+	default:
+		return nil, ErrInvalidDiscountType
+	}
+
+	var merchandise model.Money
+	for _, share := range shares {
+		merchandise += share
+	}
+	discount := merchandise + shippingDiscount
+
+	result := &model.DiscountResult{
+		Currency:            cartCurrency(cart),
+		Subtotal:            total,
+		Discount:            discount,
+		MerchandiseDiscount: merchandise,
+		ShippingDiscount:    shippingDiscount,
+		Total:               total - discount,
+		Items:               make([]model.ItemDiscount, 0, len(cart.Items)),
+		Rewards:             rewards,
+		Tier:                progress,
+		Rate:                rate,
+	}
+
+	for i, item := range cart.Items {
+		result.Items = append(result.Items, model.ItemDiscount{
+			ID:       item.ID,
+			Price:    item.Price,
+			Quantity: item.Units(),
+			Discount: shares[i],
+			Total:    amounts[i] - shares[i],
+		})
+	}
+
+	return result, nil
+}
+
+// eligibleBase returns what is left of the lines eligible for the coupon
+func eligibleBase(coupon *model.Coupon, cart *model.Cart, amounts []model.Money) model.Money {
+	var base model.Money
+	for i, item := range cart.Items {
+		if isApplicableItem(coupon, item) {
+			base += amounts[i]
+		}
+	}
+	return base
+}
+
+// amountOff computes a percentage or flat discount on the base, capped by
+// maxDiscount on percentages and never more than the base
+func amountOff(discountType string, percent float64, amount, maxDiscount, base model.Money, rounding model.RoundingMode) model.Money {
+	discount := amount
+	if discountType == model.DiscountTypePercentage {
+		discount = rounding.Percent(base, percent)
+		if maxDiscount > 0 && discount > maxDiscount {
+			discount = maxDiscount
+		}
+	}
+
+	return max(min(discount, base), 0)
+}
+
+// proportionalLines allocates the discount across the lines eligible for the
+// coupon in proportion to their amount, which sums up to base
+func proportionalLines(coupon *model.Coupon, cart *model.Cart, amounts []model.Money, base, discount model.Money, rounding model.RoundingMode) []model.Money {
+	// Allocate proportionally, the last applicable line absorbs the rounding remainder
+	last := -1
+	for i, item := range cart.Items {
+		if isApplicableItem(coupon, item) && amounts[i] > 0 {
+			last = i
+		}
+	}
+
+	shares := make([]model.Money, len(cart.Items))
+	remaining := discount
+	for i, item := range cart.Items {
+		if i == last {
+			shares[i] = remaining
+		} else if base > 0 && amounts[i] > 0 && isApplicableItem(coupon, item) {
+			shares[i] = rounding.MulDiv(discount, int64(amounts[i]), int64(base))
+			remaining -= shares[i]
+		}
+	}
+
+	return shares
+}
+
+// lineAmounts returns the amount of every cart line
+func lineAmounts(cart *model.Cart) []model.Money {
+	amounts := make([]model.Money, len(cart.Items))
+	for i, item := range cart.Items {
+		amounts[i] = item.Amount()
+	}
+	return amounts
+}
@@ -0,0 +1,53 @@
+package service
+
+import "github.com/Sensrdt/coupon-system/internal/model"
+
+// isApplicableItem reports whether the cart item is eligible for the coupon: it
+// must match an include rule, unless the coupon has none, and no exclude rule
+func isApplicableItem(coupon *model.Coupon, item model.CartItem) bool {
+	if coupon.ExcludeOnSale && item.OnSale {
+		return false
+	}
+
+	if containsAny(coupon.ExcludeCategories, item.CategoryIDs...) || contains(coupon.ExcludeBrands, item.Brand) {
+		return false
+	}
+
+	if !hasIncludeRules(coupon) {
+		return true
+	}
+
+	return contains(coupon.ApplicableItems, item.ID) ||
+		contains(coupon.ApplicableItems, item.SKU) ||
+		containsAny(coupon.IncludeCategories, item.CategoryIDs...) ||
+		contains(coupon.IncludeBrands, item.Brand)
+}
+
+// hasIncludeRules reports whether the coupon is limited to some items, categories
+// or brands rather than the whole cart
+func hasIncludeRules(coupon *model.Coupon) bool {
+	return len(coupon.ApplicableItems) > 0 || len(coupon.IncludeCategories) > 0 || len(coupon.IncludeBrands) > 0
+}
+
+// contains reports whether the list holds the non-empty value
+func contains(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether the list holds any of the values
+func containsAny(list []string, values ...string) bool {
+	for _, value := range values {
+		if contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package service
+
+import "github.com/Sensrdt/coupon-system/internal/model"
+
+// Error types
+var (
+	ErrInvalidCouponCode       = model.NewError(model.KindValidation, "invalid_coupon_code", "invalid coupon code")
+	ErrInvalidDiscountType     = model.NewError(model.KindValidation, "invalid_discount_type", "invalid discount type")
+	ErrInvalidDiscountValue    = model.NewError(model.KindValidation, "invalid_discount_value", "invalid discount value")
+	ErrInvalidDiscountAmount   = model.NewError(model.KindValidation, "invalid_discount_amount", "invalid discount amount")
+	ErrInvalidCurrency         = model.NewError(model.KindValidation, "invalid_currency", "invalid currency")
+	ErrInvalidPrices           = model.NewError(model.KindValidation, "invalid_prices", "invalid currency prices")
+	ErrInvalidMinOrderValue    = model.NewError(model.KindValidation, "invalid_min_order_value", "invalid minimum order value")
+	ErrInvalidMaxDiscount      = model.NewError(model.KindValidation, "invalid_max_discount", "invalid maximum discount")
+	ErrInvalidBuyQuantity      = model.NewError(model.KindValidation, "invalid_buy_quantity", "invalid buy quantity")
+	ErrInvalidGetQuantity      = model.NewError(model.KindValidation, "invalid_get_quantity", "invalid get quantity")
+	ErrInvalidMaxApplications  = model.NewError(model.KindValidation, "invalid_max_applications", "invalid maximum applications")
+	ErrInvalidTiers            = model.NewError(model.KindValidation, "invalid_tiers", "invalid discount tiers")
+	ErrInvalidUsageLimit       = model.NewError(model.KindValidation, "invalid_usage_limit", "invalid usage limit")
+	ErrInvalidPerCustomerLimit = model.NewError(model.KindValidation, "invalid_per_customer_limit", "invalid per customer limit")
+	ErrInvalidDateRange        = model.NewError(model.KindValidation, "invalid_date_range", "invalid date range")
+	ErrInvalidOrderID          = model.NewError(model.KindValidation, "invalid_order_id", "invalid order id")
+	ErrInvalidReservationTTL   = model.NewError(model.KindValidation, "invalid_reservation_ttl", "invalid reservation ttl")
+	ErrInvalidRefundAmount     = model.NewError(model.KindValidation, "invalid_refund_amount", "invalid refund amount")
+	ErrInvalidSortField        = model.NewError(model.KindValidation, "invalid_sort_field", "invalid sort field")
+	ErrInvalidPageSize         = model.NewError(model.KindValidation, "invalid_page_size", "invalid page size")
+	ErrInvalidRule             = model.NewError(model.KindValidation, "invalid_rule", "invalid rule")
+	ErrInvalidExchangeRate     = model.NewError(model.KindValidation, "invalid_exchange_rate", "invalid exchange rate")
+	ErrInvalidCart             = model.NewError(model.KindValidation, "invalid_cart", "invalid cart")
+	ErrCartOverflow            = model.NewError(model.KindValidation, "cart_overflow", "cart amounts are too large")
+	ErrCartTotalMismatch       = model.NewError(model.KindValidation, "cart_total_mismatch", "cart total does not match its items and charges")
+	ErrCouponNotFound          = model.NewError(model.KindNotFound, "coupon_not_found", "coupon not found")
+	ErrCouponNotApplicable     = model.NewError(model.KindRuleViolation, "coupon_not_applicable", "coupon is not applicable to the cart")
+)
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// ListLedgerEntries returns the redemption ledger entries matching the filter
+func (s *CouponService) ListLedgerEntries(ctx context.Context, filter *model.LedgerFilter) ([]*model.LedgerEntry, error) {
+	return s.repo.ListLedgerEntries(ctx, filter)
+}
+
+// ReconcileUsage recomputes every coupon's usage count from the ledger and reports
+// the coupons that drifted. With fix set the usage counts are corrected.
+func (s *CouponService) ReconcileUsage(ctx context.Context, fix bool) ([]*model.UsageDrift, error) {
+	coupons, err := s.repo.GetAllCoupons(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := s.repo.LedgerUsageCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]*model.UsageDrift, 0)
+	for _, coupon := range coupons {
+		if coupon.UsageCount == ledger[coupon.ID] {
+			continue
+		}
+
+		drift := &model.UsageDrift{
+			CouponID:    coupon.ID,
+			Code:        coupon.Code,
+			UsageCount:  coupon.UsageCount,
+			LedgerCount: ledger[coupon.ID],
+		}
+
+		if fix {
+			// The ledger may have moved since it was read, so the count is
+			// recomputed where it is set
+			count, err := s.repo.SyncUsageCount(ctx, coupon.ID)
+			if err != nil {
+				return nil, err
+			}
+			drift.LedgerCount = count
+			drift.Fixed = true
+			s.invalidateCoupon(coupon.Code, true)
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// promotionUnits is a run of units of one cart line that share a price. A line's
+// amount spread evenly over its units leaves at most two runs, so promotions work
+// on counts and their cost does not grow with quantities.
+type promotionUnits struct {
+	line  int
+	price model.Money
+	count int
+}
+
+// isPromotion reports whether the discount type rewards units of the cart lines
+// rather than discounting its amount
+func isPromotion(discountType string) bool {
+	return discountType == model.DiscountTypeBuyXGetY || discountType == model.DiscountTypeCheapestFree
+}
+
+// promotionRewards returns the units the promotion discounts, given what is left
+// of each line. A buy-X-get-Y coupon pays for its rewards with the most expensive
+// qualifying units and rewards the cheapest reward units, and a cheapest-free
+// coupon groups the qualifying units from the most expensive down and rewards the
+// cheapest units of each group. Either repeats up to MaxApplications times, or as
+// often as the cart allows when that is zero.
+func promotionRewards(coupon *model.Coupon, cart *model.Cart, amounts []model.Money) []promotionUnits {
+	if coupon.BuyQuantity <= 0 || coupon.GetQuantity <= 0 {
+		return nil
+	}
+
+	qualifying := cartUnits(cart, amounts, func(item model.CartItem) bool {
+		return isApplicableItem(coupon, item)
+	})
+	sort.SliceStable(qualifying, func(i, j int) bool { return qualifying[i].price > qualifying[j].price })
+
+	switch coupon.DiscountType {
+	case model.DiscountTypeBuyXGetY:
+		eligible := qualifying
+		if len(coupon.RewardItems) > 0 {
+			eligible = cartUnits(cart, amounts, func(item model.CartItem) bool {
+				return contains(coupon.RewardItems, item.ID) || contains(coupon.RewardItems, item.SKU)
+			})
+		}
+		return buyXGetY(coupon, qualifying, eligible)
+	case model.DiscountTypeCheapestFree:
+		return cheapestFree(coupon, qualifying)
+	}
+	return nil
+}
+
+// cheapestFree splits the qualifying units, which come most expensive first, into
+// groups of BuyQuantity and rewards the last GetQuantity units of each group
+func cheapestFree(coupon *model.Coupon, qualifying []promotionUnits) []promotionUnits {
+	total := 0
+	for _, units := range qualifying {
+		total += units.count
+	}
+	groups := total / coupon.BuyQuantity
+	if coupon.MaxApplications > 0 {
+		groups = min(groups, coupon.MaxApplications)
+	}
+
+	// rewardedBefore counts the rewarded units among the first n units
+	end := groups * coupon.BuyQuantity
+	rewardedBefore := func(n int) int {
+		n = min(n, end)
+		return n/coupon.BuyQuantity*coupon.GetQuantity + max(0, n%coupon.BuyQuantity-(coupon.BuyQuantity-coupon.GetQuantity))
+	}
+
+	var rewards []promotionUnits
+	start := 0
+	for _, units := range qualifying {
+		if n := rewardedBefore(start+units.count) - rewardedBefore(start); n > 0 {
+			rewards = append(rewards, promotionUnits{line: units.line, price: units.price, count: n})
+		}
+		start += units.count
+	}
+	return rewards
+}
+
+// buyXGetY picks the reward units of a buy-X-get-Y coupon. The qualifying units
+// come most expensive first; a unit in both sets is used at most once.
+func buyXGetY(coupon *model.Coupon, qualifying, eligible []promotionUnits) []promotionUnits {
+	eligible = append([]promotionUnits(nil), eligible...)
+	sort.SliceStable(eligible, func(i, j int) bool { return eligible[i].price < eligible[j].price })
+
+	// Units left of each run, shared by both sets. A line's runs differ in price.
+	type runKey struct {
+		line  int
+		price model.Money
+	}
+	key := func(units promotionUnits) runKey { return runKey{units.line, units.price} }
+	left := make(map[runKey]int)
+	for _, runs := range [][]promotionUnits{qualifying, eligible} {
+		for _, units := range runs {
+			left[key(units)] = units.count
+		}
+	}
+	next := func(runs []promotionUnits, i int) int {
+		for i < len(runs) && left[key(runs[i])] == 0 {
+			i++
+		}
+		return i
+	}
+	take := func(runs []promotionUnits, i, n int) ([]promotionUnits, bool) {
+		var taken []promotionUnits
+		for ; i < len(runs) && n > 0; i++ {
+			k := key(runs[i])
+			if count := min(left[k], n); count > 0 {
+				left[k] -= count
+				n -= count
+				taken = append(taken, promotionUnits{line: runs[i].line, price: runs[i].price, count: count})
+			}
+		}
+		return taken, n == 0
+	}
+
+	var rewards []promotionUnits
+	got, bought := 0, 0
+	for applied := 0; coupon.MaxApplications == 0 || applied < coupon.MaxApplications; {
+		got, bought = next(eligible, got), next(qualifying, bought)
+		if got == len(eligible) || bought == len(qualifying) {
+			break
+		}
+
+		// Apply as often as the cheapest reward run and the most expensive
+		// qualifying run allow at once
+		g, b := key(eligible[got]), key(qualifying[bought])
+		times := min(left[g]/coupon.GetQuantity, left[b]/coupon.BuyQuantity)
+		if g == b {
+			times = left[g] / (coupon.GetQuantity + coupon.BuyQuantity)
+		}
+		if coupon.MaxApplications > 0 {
+			times = min(times, coupon.MaxApplications-applied)
+		}
+		if times > 0 {
+			left[g] -= times * coupon.GetQuantity
+			left[b] -= times * coupon.BuyQuantity
+			rewards = append(rewards, promotionUnits{line: g.line, price: g.price, count: times * coupon.GetQuantity})
+			applied += times
+			continue
+		}
+
+		// An application that spans runs uses up at least one of them
+		reward, ok := take(eligible, got, coupon.GetQuantity)
+		if !ok {
+			break
+		}
+		if _, ok := take(qualifying, bought, coupon.BuyQuantity); !ok {
+			break
+		}
+		rewards = append(rewards, reward...)
+		applied++
+	}
+	return rewards
+}
+
+// cartUnits splits the cart lines that match into runs of equally priced units.
+// A line that does not split evenly puts the odd minor units on its first units.
+func cartUnits(cart *model.Cart, amounts []model.Money, match func(model.CartItem) bool) []promotionUnits {
+	var runs []promotionUnits
+	for i, item := range cart.Items {
+		if !match(item) || amounts[i] <= 0 {
+			continue
+		}
+		count := model.Money(item.Units())
+		price, odd := amounts[i]/count, amounts[i]%count
+		if odd > 0 {
+			runs = append(runs, promotionUnits{line: i, price: price + 1, count: int(odd)})
+		}
+		runs = append(runs, promotionUnits{line: i, price: price, count: int(count - odd)})
+	}
+	return runs
+}
+
+// promotionLines discounts the reward units of a promotion and returns each
+// line's share along with the reward lines
+func promotionLines(coupon *model.Coupon, cart *model.Cart, amounts []model.Money, rounding model.RoundingMode) ([]model.Money, []model.RewardLine) {
+	shares := make([]model.Money, len(cart.Items))
+	counts := make([]int, len(cart.Items))
+	for _, units := range promotionRewards(coupon, cart, amounts) {
+		shares[units.line] += rounding.Percent(units.price, coupon.DiscountValue) * model.Money(units.count)
+		counts[units.line] += units.count
+	}
+
+	var rewards []model.RewardLine
+	for i, item := range cart.Items {
+		if counts[i] == 0 {
+			continue
+		}
+		shares[i] = min(shares[i], amounts[i])
+		rewards = append(rewards, model.RewardLine{
+			ID:       item.ID,
+			Price:    rounding.MulDiv(amounts[i], 1, int64(item.Units())),
+			Quantity: counts[i],
+			Discount: shares[i],
+		})
+	}
+	return shares, rewards
+}
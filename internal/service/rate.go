@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// SetExchangeRates records the rates. A rate without an effective time takes
+// effect now; one with a later time is scheduled and takes effect then.
+func (s *CouponService) SetExchangeRates(ctx context.Context, rates []*model.ExchangeRate) error {
+	if len(rates) == 0 {
+		return ErrInvalidExchangeRate
+	}
+
+	now := time.Now()
+	for _, rate := range rates {
+		if !rate.Valid() {
+			return ErrInvalidExchangeRate
+		}
+		if rate.EffectiveAt.IsZero() {
+			rate.EffectiveAt = now
+		}
+		// Stored times keep milliseconds, so a reloaded rate matches the saved one
+		rate.EffectiveAt = rate.EffectiveAt.UTC().Truncate(time.Millisecond)
+	}
+
+	if err := s.repo.SaveExchangeRates(ctx, rates); err != nil {
+		return err
+	}
+
+	s.cache.InvalidateTag(ratesTag)
+
+	return nil
+}
+
+// ListExchangeRates returns the rate of every currency pair in effect at the
+// filter's time, or now when it names none
+func (s *CouponService) ListExchangeRates(ctx context.Context, filter *model.ExchangeRateFilter) ([]*model.ExchangeRate, error) {
+	at := time.Now()
+	if filter.At != nil {
+		at = *filter.At
+	}
+	return s.repo.ListExchangeRates(ctx, at)
+}
+
+// loadRates loads the exchange rates in effect at the given time when any of the
+// coupons has to be converted into the cart's currency, and returns no rates
+// otherwise
+func (s *CouponService) loadRates(ctx context.Context, cart *model.Cart, now time.Time, coupons ...*model.Coupon) (exchangeRates, error) {
+	if !needsRates(coupons, cartCurrency(cart)) {
+		return nil, nil
+	}
+
+	rates, err := s.repo.ListExchangeRates(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	return newExchangeRates(rates), nil
+}
+
+// ratesDeadline caps the deadline of a cached result that converted amounts at
+// the time the next scheduled rate takes effect, which does not invalidate the
+// result the way recording rates does
+func (s *CouponService) ratesDeadline(ctx context.Context, now time.Time, deadline time.Time) (time.Time, error) {
+	next, err := s.repo.NextExchangeRateAt(ctx, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return earliest(deadline, next), nil
+}
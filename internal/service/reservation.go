@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+const (
+	// DefaultReservationTTL is how long a reservation holds a coupon use when no TTL is given
+	DefaultReservationTTL = 15 * time.Minute
+
+	// MaxReservationTTL is the longest a reservation may hold a coupon use
+	MaxReservationTTL = 24 * time.Hour
+)
+
+// ReserveCoupon holds one use of the coupon for the cart until ttl elapses. A zero
+// ttl uses DefaultReservationTTL.
+func (s *CouponService) ReserveCoupon(ctx context.Context, code string, cart *model.Cart, ttl time.Duration) (*model.Reservation, error) {
+	if ttl == 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	if ttl < 0 || ttl > MaxReservationTTL {
+		return nil, ErrInvalidReservationTTL
+	}
+
+	cart, err := checkCart(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon, err := s.repo.FindCouponByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	now := time.Now().UTC()
+	usage, err := s.loadUsage(ctx, cart, now, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.loadRates(ctx, cart, now, coupon)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.isApplicable(coupon, cart, now, usage, rates) {
+		return nil, ErrCouponNotApplicable
+	}
+
+	discount, err := calculateDiscount(coupon, cart, rates, s.config.Rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newReservationID()
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := &model.Reservation{
+		ID:         id,
+		CouponID:   coupon.ID,
+		CouponCode: coupon.Code,
+		CustomerID: cart.CustomerID,
+		Currency:   discount.Currency,
+		OrderTotal: discount.Subtotal,
+		Discount:   discount.Discount,
+		Status:     model.ReservationStatusActive,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	if err := s.repo.ReserveCoupon(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	s.invalidateCoupon(coupon.Code, false)
+
+	return reservation, nil
+}
+
+// CommitReservation consumes the held use for the order
+func (s *CouponService) CommitReservation(ctx context.Context, id string, orderID string) (*model.Redemption, error) {
+	if orderID == "" {
+		return nil, ErrInvalidOrderID
+	}
+
+	redemption, err := s.repo.CommitReservation(ctx, id, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateCoupon(redemption.CouponCode, false)
+	s.invalidateCustomer(redemption.CustomerID)
+
+	return redemption, nil
+}
+
+// ReleaseReservation gives the held use back to the coupon
+func (s *CouponService) ReleaseReservation(ctx context.Context, id string) (*model.Reservation, error) {
+	reservation, err := s.repo.ReleaseReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateCoupon(reservation.CouponCode, true)
+
+	return reservation, nil
+}
+
+// ExpireReservations expires every active reservation past its expiry
+func (s *CouponService) ExpireReservations(ctx context.Context) (int64, error) {
+	expired, err := s.repo.ExpireReservations(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	// The expired holds free uses of coupons that cached lists may have left out
+	if expired > 0 {
+		s.cache.InvalidateTag(catalogTag)
+	}
+
+	return expired, nil
+}
+
+// StartReservationSweeper expires stale reservations every interval until ctx is done
+func (s *CouponService) StartReservationSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				expired, err := s.ExpireReservations(ctx)
+				if err != nil {
+					log.Printf("Failed to expire reservations: %v", err)
+					continue
+				}
+				if expired > 0 {
+					log.Printf("Expired %d reservations", expired)
+				}
+			}
+		}
+	}()
+}
+
+// newReservationID returns a random reservation identifier
+func newReservationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/cache"
+	"github.com/Sensrdt/coupon-system/internal/model"
+	"github.com/Sensrdt/coupon-system/internal/rule"
+)
+
+// ruleCacheSize is how many compiled rules the service keeps
+const ruleCacheSize = 1000
+
+// newRuleCache returns the cache of compiled rules, keyed by their source
+func newRuleCache() cache.Cache {
+	return cache.NewLRU(ruleCacheSize)
+}
+
+// checkRule compiles the coupon's rule expression, if it has one
+func checkRule(coupon *model.Coupon) error {
+	if coupon.Rule == "" {
+		return nil
+	}
+	if _, err := rule.Compile(coupon.Rule); err != nil {
+		return ErrInvalidRule.WithDetail(err.Error())
+	}
+	return nil
+}
+
+// compileRule returns the compiled rule, compiling it only the first time the
+// source is seen
+func (s *CouponService) compileRule(source string) (*rule.Program, error) {
+	if cached, ok := s.rules.Get(source); ok {
+		return cached.(*rule.Program), nil
+	}
+
+	program, err := rule.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	s.rules.Set(source, program)
+	return program, nil
+}
+
+// evalRule reports whether the cart satisfies the coupon's rule expression. A
+// coupon without a rule is satisfied by every cart. The error explains a rule
+// that cannot be evaluated, such as one exceeding its evaluation budget.
+func (s *CouponService) evalRule(coupon *model.Coupon, cart *model.Cart, now time.Time, usage *couponUsage) (bool, error) {
+	if coupon.Rule == "" {
+		return true, nil
+	}
+
+	// Rules are checked when the coupon is saved, so compiling is not expected to fail
+	program, err := s.compileRule(coupon.Rule)
+	if err != nil {
+		return false, err
+	}
+	return program.Eval(&rule.Env{Cart: cart, CustomerOrders: usage.customerOrders, Now: now})
+}
+
+// ruleDeadline returns the start of the next minute when one of the coupons has
+// a rule reading the current time, as its result may change then. It is the
+// zero time when none of them does.
+func (s *CouponService) ruleDeadline(now time.Time, coupons ...*model.Coupon) time.Time {
+	for _, coupon := range coupons {
+		if coupon.Rule == "" {
+			continue
+		}
+		if program, err := s.compileRule(coupon.Rule); err != nil || program.UsesNow() {
+			return now.Truncate(time.Minute).Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
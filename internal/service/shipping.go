@@ -0,0 +1,35 @@
+package service
+
+import "github.com/Sensrdt/coupon-system/internal/model"
+
+// isShippingDiscount reports whether the discount type comes off the cart's
+// shipping rather than its lines
+func isShippingDiscount(discountType string) bool {
+	switch discountType {
+	case model.DiscountTypeFreeShipping, model.DiscountTypeShippingPercentage, model.DiscountTypeShippingFlat:
+		return true
+	}
+	return false
+}
+
+// shippingEligible reports whether the cart's shipping method is one the coupon
+// is limited to, or the coupon is not limited to any
+func shippingEligible(coupon *model.Coupon, cart *model.Cart) bool {
+	return len(coupon.ShippingMethods) == 0 || contains(coupon.ShippingMethods, cart.ShippingMethod)
+}
+
+// shippingOff computes the coupon's discount on what is left of the shipping
+func shippingOff(coupon *model.Coupon, cart *model.Cart, shipping model.Money, rounding model.RoundingMode) model.Money {
+	if !shippingEligible(coupon, cart) {
+		return 0
+	}
+
+	switch coupon.DiscountType {
+	case model.DiscountTypeFreeShipping:
+		return shipping
+	case model.DiscountTypeShippingPercentage:
+		return amountOff(model.DiscountTypePercentage, coupon.DiscountValue, 0, coupon.MaxDiscount, shipping, rounding)
+	default:
+		return amountOff(model.DiscountTypeFlat, 0, coupon.DiscountAmount, 0, shipping, rounding)
+	}
+}
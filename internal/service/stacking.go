@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Sensrdt/coupon-system/internal/model"
+)
+
+// MaxStackedCoupons is the most coupons the optimizer combines on one cart
+const MaxStackedCoupons = 3
+
+// MaxStackCandidates is the most coupons of one stack group the optimizer tries
+// combinations of. The coupons with the largest discounts on their own are kept.
+const MaxStackCandidates = 10
+
+// BestCoupons searches the coupons applicable to the cart for the combination
+// that gives the largest total discount under the stacking rules. Exclusive
+// coupons and coupons without a stack group are only used alone, and other
+// coupons stack with coupons that share their stack group. Stacked coupons apply
+// in priority order, each to the cart left after the ones before it.
+func (s *CouponService) BestCoupons(ctx context.Context, cart *model.Cart) (*model.CouponCombination, error) {
+	applicable, err := s.GetApplicableCoupons(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*model.Coupon, 0, len(applicable))
+	discounts := make(map[*model.Coupon]model.Money, len(applicable))
+	for _, coupon := range applicable {
+		candidates = append(candidates, coupon.Coupon)
+		discounts[coupon.Coupon] = coupon.Discount.Discount
+	}
+	sortByPriority(candidates)
+
+	rates, err := s.loadRates(ctx, cart, time.Now(), candidates...)
+	if err != nil {
+		return nil, err
+	}
+
+	best, err := applyCombination(nil, cart, rates, s.config.Rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	consider := func(coupons []*model.Coupon) error {
+		combination, err := applyCombination(coupons, cart, rates, s.config.Rounding)
+		if err != nil {
+			return err
+		}
+		if betterCombination(combination, best) {
+			best = combination
+		}
+		return nil
+	}
+
+	groups := make(map[string][]*model.Coupon)
+	for _, coupon := range candidates {
+		if coupon.Exclusive || coupon.StackGroup == "" {
+			if err := consider([]*model.Coupon{coupon}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		groups[coupon.StackGroup] = append(groups[coupon.StackGroup], coupon)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Large groups are cut down first, as the combinations grow with the cube of their size
+	for _, name := range names {
+		group := topCandidates(groups[name], discounts, MaxStackCandidates)
+		if err := forEachCombination(group, MaxStackedCoupons, consider); err != nil {
+			return nil, err
+		}
+	}
+
+	return best, nil
+}
+
+// applyCombination applies the coupons, already in priority order, to the cart
+// one after another and sums up their discounts
+func applyCombination(coupons []*model.Coupon, cart *model.Cart, rates exchangeRates, rounding model.RoundingMode) (*model.CouponCombination, error) {
+	combination := &model.CouponCombination{
+		Coupons: make([]*model.ApplicableCoupon, 0, len(coupons)),
+		Discount: &model.DiscountResult{
+			Currency: cartCurrency(cart),
+			Subtotal: cart.Total,
+			Total:    cart.Total,
+			Items:    make([]model.ItemDiscount, 0, len(cart.Items)),
+		},
+	}
+	amounts := lineAmounts(cart)
+	for i, item := range cart.Items {
+		combination.Discount.Items = append(combination.Discount.Items, model.ItemDiscount{
+			ID:       item.ID,
+			Price:    item.Price,
+			Quantity: item.Units(),
+			Total:    amounts[i],
+		})
+	}
+
+	shipping := cart.Shipping
+	total := cart.Total
+	for _, coupon := range coupons {
+		discount, err := discountLines(coupon, cart, amounts, shipping, total, rates, rounding)
+		if err != nil {
+			return nil, err
+		}
+
+		combination.Coupons = append(combination.Coupons, &model.ApplicableCoupon{Coupon: coupon, Discount: discount})
+
+		// The next coupon applies to what is left of each line, of the shipping
+		// and of the total
+		shipping -= discount.ShippingDiscount
+		total = discount.Total
+		for i, item := range discount.Items {
+			amounts[i] = item.Total
+
+			line := &combination.Discount.Items[i]
+			line.Discount += item.Discount
+			line.Total = item.Total
+		}
+		combination.Discount.Discount += discount.Discount
+		combination.Discount.MerchandiseDiscount += discount.MerchandiseDiscount
+		combination.Discount.ShippingDiscount += discount.ShippingDiscount
+		combination.Discount.Total = discount.Total
+	}
+
+	return combination, nil
+}
+
+// betterCombination reports whether a gives a larger discount than b, preferring
+// fewer coupons when the discounts are equal
+func betterCombination(a, b *model.CouponCombination) bool {
+	if a.Discount.Discount != b.Discount.Discount {
+		return a.Discount.Discount > b.Discount.Discount
+	}
+	return len(a.Coupons) < len(b.Coupons)
+}
+
+// forEachCombination calls fn with every non-empty combination of at most size
+// coupons, keeping the coupons in their given order
+func forEachCombination(coupons []*model.Coupon, size int, fn func([]*model.Coupon) error) error {
+	var walk func(start int, chosen []*model.Coupon) error
+	walk = func(start int, chosen []*model.Coupon) error {
+		if len(chosen) > 0 {
+			if err := fn(chosen); err != nil {
+				return err
+			}
+		}
+		if len(chosen) == size {
+			return nil
+		}
+		for i := start; i < len(coupons); i++ {
+			if err := walk(i+1, append(chosen[:len(chosen):len(chosen)], coupons[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(0, nil)
+}
+
+// topCandidates returns the n coupons with the largest discounts, keeping the
+// coupons in their given order
+func topCandidates(coupons []*model.Coupon, discounts map[*model.Coupon]model.Money, n int) []*model.Coupon {
+	if len(coupons) <= n {
+		return coupons
+	}
+
+	top := append([]*model.Coupon(nil), coupons...)
+	sort.SliceStable(top, func(i, j int) bool {
+		return discounts[top[i]] > discounts[top[j]]
+	})
+	top = top[:n]
+	sortByPriority(top)
+	return top
+}
+
+// sortByPriority orders coupons by descending priority, then by code
+func sortByPriority(coupons []*model.Coupon) {
+	sort.SliceStable(coupons, func(i, j int) bool {
+		if coupons[i].Priority != coupons[j].Priority {
+			return coupons[i].Priority > coupons[j].Priority
+		}
+		return coupons[i].Code < coupons[j].Code
+	})
+}
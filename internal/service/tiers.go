@@ -0,0 +1,52 @@
+package service
+
+import "github.com/Sensrdt/coupon-system/internal/model"
+
+// tierProgress finds the highest tier the spend reaches and how much more it
+// takes to reach the next one. The tiers are in ascending order of MinSpend.
+func tierProgress(tiers []model.DiscountTier, spend model.Money) *model.TierProgress {
+	progress := &model.TierProgress{Spend: spend}
+	for i := range tiers {
+		tier := tiers[i]
+		if spend < tier.MinSpend {
+			progress.Next = &tier
+			progress.Remaining = tier.MinSpend - spend
+			break
+		}
+		progress.Level = i + 1
+		progress.Reached = &tier
+	}
+	return progress
+}
+
+// checkTiers validates the tiers of a tiered coupon: each gives a valid
+// percentage or flat discount, at a strictly higher spend than the one before
+func checkTiers(tiers []model.DiscountTier) error {
+	if len(tiers) == 0 {
+		return ErrInvalidTiers
+	}
+
+	for i, tier := range tiers {
+		if !validAmount(tier.MinSpend) || (i > 0 && tier.MinSpend <= tiers[i-1].MinSpend) {
+			return ErrInvalidTiers
+		}
+
+		if tier.DiscountType != model.DiscountTypePercentage && tier.DiscountType != model.DiscountTypeFlat {
+			return ErrInvalidTiers
+		}
+
+		if tier.DiscountType == model.DiscountTypePercentage && (tier.DiscountValue <= 0 || tier.DiscountValue > 100) {
+			return ErrInvalidTiers
+		}
+
+		if tier.DiscountType == model.DiscountTypeFlat && tier.DiscountAmount <= 0 {
+			return ErrInvalidTiers
+		}
+
+		if !validAmount(tier.DiscountAmount) || !validAmount(tier.MaxDiscount) {
+			return ErrInvalidTiers
+		}
+	}
+
+	return nil
+}